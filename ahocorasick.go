@@ -0,0 +1,155 @@
+package main
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ahoCorasick は複数の文字列を1回の走査で探すオートマトン（Aho–Corasick法）。
+// type: wordlist と type: dictionary のマッチや、正規表現の接頭辞による絞り込み（engine.go）に使う
+type ahoCorasick struct {
+	nodes     []acNode
+	wholeWord bool
+}
+
+type acNode struct {
+	next   map[byte]int
+	fail   int
+	output int // fail をたどって最初に見つかる、キーが終わる節点（なければ -1）
+	length int // この節点で終わるキーのバイト長（キーが終わらなければ 0）
+}
+
+// newAhoCorasick は keys からオートマトンを作る。空のキーは無視する
+func newAhoCorasick(keys []string, wholeWord bool) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{output: -1}}, wholeWord: wholeWord}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		state := 0
+		for i := 0; i < len(key); i++ {
+			next, ok := ac.nodes[state].next[key[i]]
+			if !ok {
+				next = len(ac.nodes)
+				ac.nodes = append(ac.nodes, acNode{output: -1})
+				if ac.nodes[state].next == nil {
+					ac.nodes[state].next = make(map[byte]int)
+				}
+				ac.nodes[state].next[key[i]] = next
+			}
+			state = next
+		}
+		ac.nodes[state].length = len(key)
+	}
+	ac.buildFailureLinks()
+	return ac
+}
+
+// buildFailureLinks は幅優先で各節点の fail と output を設定する
+func (ac *ahoCorasick) buildFailureLinks() {
+	queue := make([]int, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[state].next {
+			fail := ac.nodes[state].fail
+			for {
+				if next, ok := ac.nodes[fail].next[b]; ok {
+					ac.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			target := ac.nodes[child].fail
+			if ac.nodes[target].length > 0 {
+				ac.nodes[child].output = target
+			} else {
+				ac.nodes[child].output = ac.nodes[target].output
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// each はテキスト中のすべてのキーの出現位置（重なりを含む）を、終了位置の順に fn に渡す
+func (ac *ahoCorasick) each(text string, fn func(start, end int)) {
+	state := 0
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.nodes[state].next[text[i]]; ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = ac.nodes[state].fail
+		}
+
+		end := i + 1
+		for node := state; node > 0; node = ac.nodes[node].output {
+			if ac.nodes[node].length > 0 {
+				fn(end-ac.nodes[node].length, end)
+			}
+		}
+	}
+}
+
+// findAll は重ならないマッチの範囲 [開始, 終了] を先頭から順に返す。
+// 左端のマッチを優先し、同じ位置から始まるものは最も長いキーを選ぶ
+func (ac *ahoCorasick) findAll(text string) [][]int {
+	var candidates [][]int
+	ac.each(text, func(start, end int) {
+		if ac.wholeWord && !isWholeWord(text, start, end) {
+			return
+		}
+		candidates = append(candidates, []int{start, end})
+	})
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i][0] != candidates[j][0] {
+			return candidates[i][0] < candidates[j][0]
+		}
+		return candidates[i][1] > candidates[j][1]
+	})
+
+	var locs [][]int
+	last := 0
+	for _, loc := range candidates {
+		if loc[0] < last {
+			continue
+		}
+		locs = append(locs, loc)
+		last = loc[1]
+	}
+	return locs
+}
+
+// isWholeWord は text[start:end] の前後が単語の文字でないかどうかを返す
+func isWholeWord(text string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWordRune は whole_word の判定で単語の一部とみなす文字かどうかを返す
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAhoCorasick_FindAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      []string
+		wholeWord bool
+		text      string
+		expected  []string
+	}{
+		{
+			name:     "overlapping keys",
+			keys:     []string{"he", "she", "his", "hers"},
+			text:     "ushers and his",
+			expected: []string{"she", "his"},
+		},
+		{
+			name:     "leftmost wins over longer later match",
+			keys:     []string{"ab", "bcde"},
+			text:     "abcde",
+			expected: []string{"ab"},
+		},
+		{
+			name:     "longest at the same start",
+			keys:     []string{"東京", "東京都", "京都"},
+			text:     "東京都と京都と東京",
+			expected: []string{"東京都", "京都", "東京"},
+		},
+		{
+			name:     "key found through failure link",
+			keys:     []string{"abcd", "bc"},
+			text:     "abce",
+			expected: []string{"bc"},
+		},
+		{
+			name:      "whole word",
+			keys:      []string{"go", "gopher"},
+			wholeWord: true,
+			text:      "go gopher golang ergo",
+			expected:  []string{"go", "gopher"},
+		},
+		{
+			name:     "empty keys are ignored",
+			keys:     []string{"", "x"},
+			text:     "axb",
+			expected: []string{"x"},
+		},
+		{
+			name:     "no keys",
+			keys:     nil,
+			text:     "anything",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac := newAhoCorasick(tt.keys, tt.wholeWord)
+			var found []string
+			for _, loc := range ac.findAll(tt.text) {
+				found = append(found, tt.text[loc[0]:loc[1]])
+			}
+			require.Equal(t, tt.expected, found)
+		})
+	}
+}
+
+// naiveFindAll は各位置で最長のキーを探す単純な実装（比較用）
+func naiveFindAll(keys []string, text string) [][]int {
+	var locs [][]int
+	for i := 0; i < len(text); {
+		end := -1
+		for _, key := range keys {
+			if key != "" && strings.HasPrefix(text[i:], key) && i+len(key) > end {
+				end = i + len(key)
+			}
+		}
+		if end < 0 {
+			i++
+			continue
+		}
+		locs = append(locs, []int{i, end})
+		i = end
+	}
+	return locs
+}
+
+func TestAhoCorasick_MatchesNaive(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomString := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[rng.Intn(3)]
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 200; i++ {
+		keys := make([]string, 1+rng.Intn(6))
+		for j := range keys {
+			keys[j] = randomString(1 + rng.Intn(4))
+		}
+		text := randomString(rng.Intn(40))
+		require.Equal(t, naiveFindAll(keys, text), newAhoCorasick(keys, false).findAll(text), "keys=%q text=%q", keys, text)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// 入力ファイルのアーカイブ形式
+const (
+	archiveZip = "zip"
+	archiveTar = "tar"
+)
+
+// archiveSeparator はアーカイブのファイル名とエントリのパスの区切り（bundle.zip!/path/page.html）
+const archiveSeparator = "!/"
+
+// detectArchive は先頭のマジックバイトからアーカイブ形式を判定する（アーカイブでなければ空文字列）
+func detectArchive(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return archiveZip
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return archiveTar
+	}
+	return ""
+}
+
+// memberName はアーカイブのエントリを表示する名前（bundle.zip!/path/page.html）を返す
+func memberName(archivePath, member string) string {
+	return archivePath + archiveSeparator + member
+}
+
+// walkArchive はアーカイブの通常のファイルのエントリごとに fn を呼ぶ
+func walkArchive(input *inputData, fn func(member string, content []byte) error) error {
+	switch input.archive {
+	case archiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(input.content), int64(len(input.content)))
+		if err != nil {
+			return msgErrorf(msgArchiveReadError, input.path, err)
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			content, err := readZipFile(f)
+			if err != nil {
+				return msgErrorf(msgArchiveReadError, input.path, err)
+			}
+			if err := fn(f.Name, content); err != nil {
+				return err
+			}
+		}
+
+	case archiveTar:
+		tr := tar.NewReader(bytes.NewReader(input.content))
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return msgErrorf(msgArchiveReadError, input.path, err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return msgErrorf(msgArchiveReadError, input.path, err)
+			}
+			if err := fn(hdr.Name, content); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// extractArchive はアーカイブのテキストのエントリごとにマッチを収集する（バイナリのエントリは --binary に従う）。
+// マッチの File には bundle.zip!/path/page.html の形式の名前を設定する
+func extractArchive(input *inputData, config *Config, opts *inputOptions) ([]Match, error) {
+	var allMatches []Match
+	err := walkArchive(input, func(member string, content []byte) error {
+		name := memberName(input.path, member)
+		if skip, err := opts.skipBinary(name, content, false); skip || err != nil {
+			return err
+		}
+		doc, err := newDocument(name, content, opts)
+		if err != nil {
+			return err
+		}
+		for _, match := range extractMatchesInFile(doc.text, doc.name, config) {
+			match.File = doc.name
+			allMatches = append(allMatches, match)
+		}
+		return nil
+	})
+	return allMatches, err
+}
+
+// memberTransform はアーカイブのエントリの内容を書き換える。changed が false なら元のエントリをそのまま使う
+type memberTransform func(member string, content []byte) (replaced []byte, changed bool, err error)
+
+// replaceArchive はアーカイブのテキストのエントリを置換した新しいアーカイブを返す。
+// バイナリのエントリと置換しなかったエントリは名前、更新日時、パーミッションを含めてそのまま書き出す
+func replaceArchive(input *inputData, config *Config, opts *inputOptions, outputEncoding string) ([]byte, error) {
+	transform := func(member string, content []byte) ([]byte, bool, error) {
+		name := memberName(input.path, member)
+		if skip, err := opts.skipBinary(name, content, true); skip || err != nil {
+			return content, false, err
+		}
+		doc, err := newDocument(name, content, opts)
+		if err != nil {
+			return nil, false, err
+		}
+		fmt.Fprint(os.Stderr, msgf(msgArchiveMember, doc.name))
+		replaced := performReplacementsInFile(doc.text, doc.name, config)
+		if replaced == doc.text {
+			return content, false, nil
+		}
+		output, err := doc.encode(replaced, outputEncoding)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", doc.name, err)
+		}
+		return output, true, nil
+	}
+
+	var output []byte
+	var err error
+	switch input.archive {
+	case archiveZip:
+		output, err = rewriteZip(input.content, transform)
+	case archiveTar:
+		output, err = rewriteTar(input.content, transform)
+	}
+	if err != nil {
+		return nil, msgErrorf(msgArchiveWriteError, input.path, err)
+	}
+	return output, nil
+}
+
+// rewriteZip は zip の通常のファイルのエントリを transform で書き換えた新しい zip を返す。
+// 書き換えなかったエントリは圧縮済みのデータをそのままコピーする
+func rewriteZip(data []byte, transform memberTransform) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := zw.SetComment(zr.Comment); err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			if err := zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		replaced, changed, err := transform(f.Name, content)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			if err := zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// 名前、パーミッション、圧縮方式は元のエントリに合わせ、更新日時は現在時刻にする
+		fh := f.FileHeader
+		fh.Modified = time.Now()
+		fh.Extra = nil
+		fh.CRC32 = 0
+		fh.CompressedSize, fh.UncompressedSize = 0, 0
+		fh.CompressedSize64, fh.UncompressedSize64 = 0, 0
+		w, err := zw.CreateHeader(&fh)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(replaced); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rewriteTar は tar の通常のファイルのエントリを transform で書き換えた新しい tar を返す
+func rewriteTar(data []byte, transform memberTransform) ([]byte, error) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			replaced, changed, err := transform(hdr.Name, content)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				// 名前、パーミッション、所有者は元のエントリに合わせ、更新日時は現在時刻にする
+				delete(hdr.PAXRecords, "size")
+				delete(hdr.PAXRecords, "mtime")
+				hdr.Size = int64(len(replaced))
+				hdr.ModTime = time.Now().Truncate(time.Second)
+				content = replaced
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// archiveEntry はテスト用のアーカイブのエントリ
+type archiveEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+var (
+	archiveModTime = time.Date(2020, 4, 1, 12, 30, 0, 0, time.UTC)
+	archiveEntries = []archiveEntry{
+		{name: "site/", mode: os.ModeDir | 0755},
+		{name: "site/index.html", content: "<p>old</p>\n<p>old again</p>\n", mode: 0644},
+		{name: "site/about.html", content: "<p>about</p>\n", mode: 0600},
+		{name: "site/logo.png", content: "\x89PNG\x00\x00old", mode: 0644},
+		{name: "site/run.sh", content: "echo old\n", mode: 0755},
+	}
+)
+
+func buildZip(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		fh := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: archiveModTime}
+		fh.SetMode(entry.mode)
+		w, err := zw.CreateHeader(fh)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func buildTar(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		hdr := &tar.Header{Name: entry.name, Mode: int64(entry.mode.Perm()), ModTime: archiveModTime, Typeflag: tar.TypeReg, Size: int64(len(entry.content))}
+		if entry.mode.IsDir() {
+			hdr.Typeflag = tar.TypeDir
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// readArchive はアーカイブのエントリを名前ごとに読み込む
+func readArchive(t *testing.T, data []byte) map[string]archiveEntry {
+	t.Helper()
+	entries := make(map[string]archiveEntry)
+	switch detectArchive(data) {
+	case archiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		for _, f := range zr.File {
+			content, err := readZipFile(f)
+			require.NoError(t, err)
+			entries[f.Name] = archiveEntry{name: f.Name, content: string(content), mode: f.Mode()}
+			if f.Name == "site/about.html" {
+				require.True(t, f.Modified.Equal(archiveModTime), "untouched entry keeps its timestamp")
+			}
+		}
+	case archiveTar:
+		tr := tar.NewReader(bytes.NewReader(data))
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			content, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			entries[hdr.Name] = archiveEntry{name: hdr.Name, content: string(content), mode: hdr.FileInfo().Mode()}
+			if hdr.Name == "site/about.html" {
+				require.True(t, hdr.ModTime.Equal(archiveModTime), "untouched entry keeps its timestamp")
+			}
+		}
+	default:
+		t.Fatalf("not an archive")
+	}
+	return entries
+}
+
+func TestDetectArchive(t *testing.T) {
+	require.Equal(t, archiveZip, detectArchive(buildZip(t, archiveEntries)))
+	require.Equal(t, archiveZip, detectArchive(buildZip(t, nil)))
+	require.Equal(t, archiveTar, detectArchive(buildTar(t, archiveEntries)))
+	require.Equal(t, "", detectArchive([]byte("PK is a plain text")))
+}
+
+func TestExtractArchive(t *testing.T) {
+	config := &Config{Patterns: []Pattern{{Name: "old", Pattern: `old`}}}
+
+	for _, kind := range []string{archiveZip, archiveTar} {
+		t.Run(kind, func(t *testing.T) {
+			data := buildZip(t, archiveEntries)
+			if kind == archiveTar {
+				data = buildTar(t, archiveEntries)
+			}
+			input := &inputData{path: "bundle." + kind, name: "bundle." + kind, content: data, archive: kind}
+
+			matches, err := extractArchive(input, config, &inputOptions{encoding: encodingAuto})
+			require.NoError(t, err)
+			var got []string
+			for _, match := range matches {
+				got = append(got, fmt.Sprintf("%s:%d", match.File, match.Line))
+			}
+			// バイナリのエントリ（logo.png）は対象にしない
+			require.Equal(t, []string{
+				"bundle." + kind + "!/site/index.html:1",
+				"bundle." + kind + "!/site/index.html:2",
+				"bundle." + kind + "!/site/run.sh:1",
+			}, got)
+		})
+	}
+}
+
+func TestReplaceArchive(t *testing.T) {
+	config := &Config{Patterns: []Pattern{{Name: "old", Pattern: `old`, Replacement: "new", When: &Condition{Extension: []string{"html"}}}}}
+
+	for _, kind := range []string{archiveZip, archiveTar} {
+		t.Run(kind, func(t *testing.T) {
+			data := buildZip(t, archiveEntries)
+			if kind == archiveTar {
+				data = buildTar(t, archiveEntries)
+			}
+			input := &inputData{path: "bundle." + kind, name: "bundle." + kind, content: data, archive: kind}
+
+			output, err := replaceArchive(input, config, &inputOptions{encoding: encodingAuto}, encodingSame)
+			require.NoError(t, err)
+			entries := readArchive(t, output)
+			require.Len(t, entries, len(archiveEntries))
+			require.Equal(t, "<p>new</p>\n<p>new again</p>\n", entries["site/index.html"].content)
+			require.Equal(t, os.FileMode(0644), entries["site/index.html"].mode.Perm())
+			require.Equal(t, "<p>about</p>\n", entries["site/about.html"].content)
+			require.Equal(t, os.FileMode(0600), entries["site/about.html"].mode.Perm())
+			require.Equal(t, "\x89PNG\x00\x00old", entries["site/logo.png"].content)
+			require.Equal(t, "echo old\n", entries["site/run.sh"].content)
+			require.Equal(t, os.FileMode(0755), entries["site/run.sh"].mode.Perm())
+			require.True(t, entries["site/"].mode.IsDir())
+		})
+	}
+}
+
+func TestRun_ReplaceArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "old"
+    pattern: 'old'
+    replacement: 'new'`), 0644))
+
+	zipFile := filepath.Join(tmpDir, "bundle.zip")
+	require.NoError(t, os.WriteFile(zipFile, buildZip(t, archiveEntries), 0644))
+	require.Equal(t, exitOK, run([]string{"replace", "-c", configFile, zipFile}))
+	output, err := os.ReadFile(filepath.Join(tmpDir, "bundle_replaced.zip"))
+	require.NoError(t, err)
+	require.Equal(t, "echo new\n", readArchive(t, output)["site/run.sh"].content)
+
+	// tar.gz は gzip で圧縮したまま保存する
+	tgzFile := filepath.Join(tmpDir, "bundle.tar.gz")
+	require.NoError(t, os.WriteFile(tgzFile, mustGzip(t, string(buildTar(t, archiveEntries))), 0644))
+	require.Equal(t, exitOK, run([]string{"replace", "-c", configFile, tgzFile}))
+	output, err = os.ReadFile(filepath.Join(tmpDir, "bundle_replaced.tar.gz"))
+	require.NoError(t, err)
+	require.Equal(t, compressionGzip, detectCompression(output))
+	output, err = decompress(output, compressionGzip)
+	require.NoError(t, err)
+	require.Equal(t, "<p>new</p>\n<p>new again</p>\n", readArchive(t, output)["site/index.html"].content)
+
+	require.Equal(t, exitOK, run([]string{"extract", "-c", configFile, tgzFile}))
+
+	// .tgz は .tar.gz として保存する
+	shortFile := filepath.Join(tmpDir, "short.tgz")
+	require.NoError(t, os.WriteFile(shortFile, mustGzip(t, string(buildTar(t, archiveEntries))), 0644))
+	require.Equal(t, exitOK, run([]string{"replace", "-c", configFile, shortFile}))
+	output, err = os.ReadFile(filepath.Join(tmpDir, "short_replaced.tar.gz"))
+	require.NoError(t, err)
+	require.Equal(t, compressionGzip, detectCompression(output))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// バイナリファイルの扱い（--binary）
+const (
+	binarySkip  = "skip"
+	binaryText  = "text"
+	binaryError = "error"
+)
+
+// binaryCheckSize はバイナリかどうかを判定するために調べる先頭のバイト数
+const binaryCheckSize = 8000
+
+// binaryRatio は不正なバイトと制御文字がこの割合を超えるとバイナリとみなす
+const binaryRatio = 0.1
+
+// isBinary は content がテキストとして扱えないバイナリかどうかを先頭の binaryCheckSize バイトから判定する。
+// NUL バイトを含むか、UTF-8、Shift_JIS、EUC-JP のいずれとして読んでも不正なバイトと制御文字が多ければバイナリとみなす
+func isBinary(content []byte) bool {
+	sample := content
+	if len(sample) > binaryCheckSize {
+		sample = sample[:binaryCheckSize]
+	}
+	if len(sample) == 0 {
+		return false
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+
+	invalid := invalidUTF8(sample)
+	if invalid > 0 {
+		sjisErrors, _ := scanShiftJIS(sample)
+		invalid = min(invalid, sjisErrors, scanEUCJP(sample))
+	}
+	return float64(invalid+controlChars(sample)) > float64(len(sample))*binaryRatio
+}
+
+// invalidUTF8 は sample を UTF-8 として読んだときの不正なバイトの数を返す。
+// 末尾で途切れた文字は数えない
+func invalidUTF8(sample []byte) int {
+	invalid := 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && size == 1 && utf8.FullRune(sample[i:]) {
+			invalid++
+		}
+		i += size
+	}
+	return invalid
+}
+
+// controlChars はテキストに通常現れない制御文字（タブ、改行、改ページ、エスケープなどを除く）の数を返す
+func controlChars(sample []byte) int {
+	count := 0
+	for _, b := range sample {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != '\v' && b != '\b' && b != 0x1b {
+			count++
+		}
+	}
+	return count
+}
+
+// skipBinary は content がバイナリの場合に --binary の指定に従って name を処理しないかどうかを返す。
+// 置換（replace が true）ではバイナリの置換結果を保存しないため、--binary=text でも処理しない
+func (o *inputOptions) skipBinary(name string, content []byte, replace bool) (bool, error) {
+	if !isBinary(content) {
+		return false, nil
+	}
+	switch {
+	case o.binary == binaryError:
+		return true, msgErrorf(msgBinaryInput, name)
+	case o.binary == binaryText && !replace:
+		return false, nil
+	case o.binary == binaryText:
+		fmt.Fprint(os.Stderr, msgf(msgBinaryNotSaved, name))
+	default:
+		fmt.Fprint(os.Stderr, msgf(msgBinarySkipped, name))
+	}
+	return true, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBinary(t *testing.T) {
+	// NUL を含まない圧縮データのようなバイト列
+	noise := make([]byte, 512)
+	for i := range noise {
+		noise[i] = byte(i*151%255 + 1)
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected bool
+	}{
+		{name: "empty", content: nil, expected: false},
+		{name: "ascii", content: []byte("TITLE: a\r\nbody\tend\n"), expected: false},
+		{name: "utf-8", content: []byte("タイトル: テスト\n本文です\n"), expected: false},
+		{name: "shift_jis", content: mustEncode(t, "タイトル: テスト\n本文です\n", encodingShiftJIS), expected: false},
+		{name: "euc-jp", content: mustEncode(t, "タイトル: テスト\n本文です\n", encodingEUCJP), expected: false},
+		{name: "nul byte", content: []byte("text\x00text"), expected: true},
+		{name: "png header", content: []byte("\x89PNG\r\n\x1a\n"), expected: true},
+		{name: "noise", content: noise, expected: true},
+		{name: "control chars", content: []byte("a\x01b\x02c\x03d\x04e"), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, isBinary(tt.content))
+		})
+	}
+}
+
+func TestRun_Binary(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	inputFile := filepath.Join(tmpDir, "image.bin")
+	require.NoError(t, os.WriteFile(inputFile, []byte("TITLE: x\x00\x01CATEGORY: Test\n"), 0644))
+	outputFile := filepath.Join(tmpDir, "image_replaced.bin")
+
+	tests := []struct {
+		name     string
+		command  string
+		args     []string
+		expected int
+	}{
+		{name: "extract skips by default", command: "extract", expected: exitOK},
+		{name: "extract as text", command: "extract", args: []string{"--binary=text"}, expected: exitOK},
+		{name: "extract error", command: "extract", args: []string{"--binary=error"}, expected: exitError},
+		{name: "replace skips by default", command: "replace", expected: exitOK},
+		{name: "replace never saves binary", command: "replace", args: []string{"--binary=text"}, expected: exitOK},
+		{name: "replace error", command: "replace", args: []string{"--binary=error"}, expected: exitError},
+		{name: "unknown mode", command: "replace", args: []string{"--binary=force"}, expected: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{tt.command, "-c", "testdata/test_config.yaml", inputFile}, tt.args...)
+			require.Equal(t, tt.expected, run(args))
+			_, err := os.Stat(outputFile)
+			require.True(t, os.IsNotExist(err), "no _replaced copy of a binary file")
+		})
+	}
+}
+
+func TestArchive_BinaryError(t *testing.T) {
+	config := &Config{Patterns: []Pattern{{Name: "old", Pattern: `old`, Replacement: "new"}}}
+	input := &inputData{path: "bundle.zip", name: "bundle.zip", content: buildZip(t, archiveEntries), archive: archiveZip}
+	opts := &inputOptions{encoding: encodingAuto, binary: binaryError}
+
+	_, err := extractArchive(input, config, opts)
+	require.ErrorContains(t, err, "bundle.zip!/site/logo.png")
+	_, err = replaceArchive(input, config, opts, encodingSame)
+	require.ErrorContains(t, err, "bundle.zip!/site/logo.png")
+
+	// text ではエントリを抽出の対象にするが、置換結果は保存しない
+	opts.binary = binaryText
+	matches, err := extractArchive(input, config, opts)
+	require.NoError(t, err)
+	require.Len(t, matches, 4)
+	output, err := replaceArchive(input, config, opts, encodingSame)
+	require.NoError(t, err)
+	require.Equal(t, "\x89PNG\x00\x00old", readArchive(t, output)["site/logo.png"].content)
+}
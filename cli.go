@@ -0,0 +1,638 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// version はリリース時に -ldflags "-X main.version=v1.2.3" で埋め込まれる
+var version = "dev"
+
+const programName = "regex-extractor"
+
+// 終了コード
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command はサブコマンドの定義
+type command struct {
+	name    string
+	summary string // メッセージキー
+	args    string // メッセージキー（位置引数の説明）
+	run     func(cmd command, args []string) error
+}
+
+// commands はヘルプに表示する順序で並べたサブコマンド一覧
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "extract", summary: msgCmdExtract, args: msgArgInputFile, run: runExtract},
+		{name: "replace", summary: msgCmdReplace, args: msgArgInputFile, run: runReplace},
+		{name: "validate", summary: msgCmdValidate, run: runValidate},
+		{name: "test", summary: msgCmdTest, args: msgArgText, run: runTest},
+		{name: "config", summary: msgCmdConfig, args: msgArgConfigSub, run: runConfig},
+		{name: "presets", summary: msgCmdPresets, args: msgArgPresetsSub, run: runPresets},
+		{name: "version", summary: msgCmdVersion, run: runVersion},
+		{name: "help", summary: msgCmdHelp, run: runHelp},
+	}
+}
+
+// usageError は使い方の誤りを表し、終了コード2で終了させる
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// run は引数を解釈してサブコマンドを実行し、終了コードを返す
+func run(args []string) int {
+	lang, err := langFromArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	currentLang = lang
+	args = trimLeadingLang(args)
+
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return exitOK
+	case "-version", "--version":
+		args = []string{"version"}
+	}
+
+	cmd, ok := findCommand(args[0])
+	if ok {
+		args = args[1:]
+	} else if strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, msgf(msgUnknownCommand, args[0]))
+		printUsage(os.Stderr)
+		return exitUsage
+	} else {
+		// コマンド省略時は extract として扱う
+		cmd, _ = findCommand("extract")
+	}
+
+	err = cmd.run(cmd, args)
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		if usageErr.err.Error() != "" {
+			fmt.Fprintln(os.Stderr, usageErr)
+		}
+		return exitUsage
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	var list strings.Builder
+	for _, cmd := range commands {
+		fmt.Fprintf(&list, "  %-9s %s\n", cmd.name, msg(cmd.summary))
+	}
+	fmt.Fprintln(w, msgf(msgUsage, list.String()))
+}
+
+// langFromArgs は --lang <値> または --lang=<値> を探し、なければ環境変数から言語を決める
+func langFromArgs(args []string) (string, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		value := ""
+		switch {
+		case (arg == "--lang" || arg == "-lang") && i+1 < len(args):
+			value = args[i+1]
+		case strings.HasPrefix(arg, "--lang="):
+			value = strings.TrimPrefix(arg, "--lang=")
+		case strings.HasPrefix(arg, "-lang="):
+			value = strings.TrimPrefix(arg, "-lang=")
+		default:
+			continue
+		}
+		lang, ok := parseLang(value)
+		if !ok {
+			return "", msgErrorf(msgUnknownLang, value)
+		}
+		return lang, nil
+	}
+	return detectLang(os.Getenv), nil
+}
+
+// trimLeadingLang はサブコマンドの前に指定された --lang を取り除く（言語は langFromArgs で決定済み）
+func trimLeadingLang(args []string) []string {
+	for len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "--lang" || arg == "-lang":
+			args = args[min(2, len(args)):]
+		case strings.HasPrefix(arg, "--lang="), strings.HasPrefix(arg, "-lang="):
+			args = args[1:]
+		default:
+			return args
+		}
+	}
+	return args
+}
+
+// newFlagSet はサブコマンド用のFlagSetを作成する。--langは全コマンド共通
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		args := ""
+		if cmd.args != "" {
+			args = msg(cmd.args)
+		}
+		fmt.Fprint(fs.Output(), msgf(msgCommandUsage, cmd.name, args, msg(cmd.summary)))
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), msg(msgOptionsHeader))
+		fs.PrintDefaults()
+	}
+	fs.String("lang", currentLang, msg(msgFlagLang))
+	return fs
+}
+
+// configOptions は設定の読み込みに関するコマンドラインオプション
+type configOptions struct {
+	files     stringList
+	presets   stringList
+	selection patternSelection
+}
+
+// addConfigFlags は繰り返し指定できる --config（短縮形 -c）と --preset、
+// パターンを絞り込む --only、--skip、--tags を登録する
+func addConfigFlags(fs *flag.FlagSet) *configOptions {
+	opts := &configOptions{}
+	fs.Var(&opts.files, "config", msg(msgFlagConfig))
+	fs.Var(&opts.files, "c", msg(msgFlagConfig))
+	fs.Var(&opts.presets, "preset", msg(msgFlagPreset))
+	fs.Var(&opts.selection.only, "only", msg(msgFlagOnly))
+	fs.Var(&opts.selection.skip, "skip", msg(msgFlagSkip))
+	fs.Var(&opts.selection.tags, "tags", msg(msgFlagTags))
+	return opts
+}
+
+// addVarFlag は置換文字列の ${var:key} に渡す --var key=value を登録する
+func addVarFlag(fs *flag.FlagSet) variables {
+	vars := variables{}
+	fs.Var(vars, "var", msg(msgFlagVar))
+	return vars
+}
+
+// addMaxCountFlag はファイルごとのマッチ数の合計の上限 --max-count を登録する
+func addMaxCountFlag(fs *flag.FlagSet) *int {
+	return fs.Int("max-count", 0, msg(msgFlagMaxCount))
+}
+
+// checkMaxCount は --max-count の値を確かめて config に設定する
+func checkMaxCount(config *Config, maxCount int) error {
+	if maxCount < 0 {
+		return &usageError{err: msgErrorf(msgNegativeMaxCount, maxCount)}
+	}
+	config.MaxCount = maxCount
+	return nil
+}
+
+// parseFlags はフラグと位置引数が混在していても解釈できるようにFlagSetを繰り返し適用する
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		// "--" 以降はすべて位置引数として扱う
+		for i, arg := range args {
+			if arg == "--" {
+				if err := fs.Parse(args[:i]); err != nil {
+					return nil, wrapFlagError(err)
+				}
+				return append(append(positional, fs.Args()...), args[i+1:]...), nil
+			}
+			if !strings.HasPrefix(arg, "-") || arg == "-" {
+				break
+			}
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, wrapFlagError(err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func wrapFlagError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	// flagパッケージがエラー内容と使い方を出力済み
+	return &usageError{err: errors.New("")}
+}
+
+// parseInputArgs は入力ファイルパスを1つだけ受け取るコマンドの引数を解釈する
+func parseInputArgs(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(positional) == 0:
+		fs.Usage()
+		return "", &usageError{err: errors.New(msg(msgMissingInput))}
+	case len(positional) > 1:
+		return "", &usageError{err: msgErrorf(msgTooManyArgs, strings.Join(positional[1:], " "))}
+	}
+	return positional[0], nil
+}
+
+// loadInput は設定ファイルと入力ファイルを読み込む（入力ファイルは圧縮されていれば展開する）
+func loadInput(configOpts *configOptions, inputFile string) (*Config, *inputData, error) {
+	config, _, err := resolveConfig(configOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	input, err := readInput(inputFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, input, nil
+}
+
+func runExtract(cmd command, args []string) error {
+	fs := newFlagSet(cmd)
+	configOpts := addConfigFlags(fs)
+	maxCount := addMaxCountFlag(fs)
+	inputOpts := addInputFlags(fs)
+	urlOpts := addURLFlags(fs)
+	inputFile, err := parseInputArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := inputOpts.check(); err != nil {
+		return err
+	}
+	if err := urlOpts.check(); err != nil {
+		return err
+	}
+	// --urls の場合はマッチを URL として集計して表示する
+	output := printResults
+	if urlOpts.enabled {
+		output = func(matches []Match, _ *Config) { printURLResults(matches, urlOpts) }
+	}
+
+	config, input, err := loadInput(configOpts, inputFile)
+	if err != nil {
+		return err
+	}
+	if err := checkMaxCount(config, *maxCount); err != nil {
+		return err
+	}
+
+	// アーカイブはエントリごとに抽出する
+	if input.archive != "" {
+		matches, err := extractArchive(input, config, inputOpts)
+		if err != nil {
+			return err
+		}
+		output(matches, config)
+		return nil
+	}
+
+	if skip, err := inputOpts.skipBinary(input.path, input.content, false); skip || err != nil {
+		return err
+	}
+	doc, err := newDocument(input.name, input.content, inputOpts)
+	if err != nil {
+		return err
+	}
+	output(extractMatchesInFile(doc.text, doc.name, config), config)
+	return nil
+}
+
+func runReplace(cmd command, args []string) error {
+	fs := newFlagSet(cmd)
+	configOpts := addConfigFlags(fs)
+	vars := addVarFlag(fs)
+	maxCount := addMaxCountFlag(fs)
+	inputOpts := addInputFlags(fs)
+	outputEncoding := fs.String("output-encoding", encodingSame, msg(msgFlagOutputEncoding))
+	compress := fs.Bool("gzip", false, msg(msgFlagGzip))
+	inputFile, err := parseInputArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := inputOpts.check(); err != nil {
+		return err
+	}
+	if *outputEncoding, err = normalizeEncoding(*outputEncoding, encodingSame); err != nil {
+		return &usageError{err: err}
+	}
+
+	config, input, err := loadInput(configOpts, inputFile)
+	if err != nil {
+		return err
+	}
+	if err := checkMaxCount(config, *maxCount); err != nil {
+		return err
+	}
+	if err := substituteVariables(config, vars, os.LookupEnv); err != nil {
+		return err
+	}
+
+	var output []byte
+	if input.archive != "" {
+		// アーカイブはエントリごとに置換した新しいアーカイブにする。tar.gz は gzip のまま保存する
+		if output, err = replaceArchive(input, config, inputOpts, *outputEncoding); err != nil {
+			return err
+		}
+		if input.archive == archiveTar && input.compression == compressionGzip {
+			*compress = true
+		}
+	} else {
+		// バイナリファイルの置換結果は保存しない
+		if skip, err := inputOpts.skipBinary(input.path, input.content, true); skip || err != nil {
+			return err
+		}
+		doc, err := newDocument(input.name, input.content, inputOpts)
+		if err != nil {
+			return err
+		}
+		replacedText := performReplacementsInFile(doc.text, doc.name, config)
+		if output, err = doc.encode(replacedText, *outputEncoding); err != nil {
+			return err
+		}
+	}
+	if *compress {
+		if output, err = gzipData(output); err != nil {
+			return msgErrorf(msgFileSaveError, err)
+		}
+	}
+
+	// 出力ファイル名を生成（元ファイル名_replaced.拡張子。gzip で保存する場合は .gz を付ける）
+	outputFile := input.outputFileName(*compress)
+
+	if err := os.WriteFile(outputFile, output, 0644); err != nil {
+		return msgErrorf(msgFileSaveError, err)
+	}
+
+	fmt.Fprint(os.Stderr, msgf(msgSavedOutput, outputFile))
+	return nil
+}
+
+func runValidate(cmd command, args []string) error {
+	fs := newFlagSet(cmd)
+	configOpts := addConfigFlags(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return &usageError{err: msgErrorf(msgTooManyArgs, strings.Join(positional, " "))}
+	}
+
+	config, _, err := resolveConfig(configOpts)
+	if err != nil {
+		return err
+	}
+
+	invalid := 0
+	for _, pattern := range config.Patterns {
+		if pattern.isEmpty() {
+			continue
+		}
+		if pattern.Scope != nil {
+			if _, err := pattern.Scope.compile(); err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgScopeError, pattern.Name, err))
+				invalid++
+			}
+		}
+		if pattern.Target != "" {
+			if _, _, err := parseTarget(pattern.Target); err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgScopeError, pattern.Name, err))
+				invalid++
+			}
+		}
+		if pattern.Markdown != nil {
+			if err := pattern.Markdown.check(); err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgScopeError, pattern.Name, err))
+				invalid++
+			}
+		}
+		if pattern.Field != "" && pattern.Type == patternTypeHTMLRemove {
+			fmt.Fprint(os.Stderr, msgf(msgFieldError, pattern.Name, msgErrorf(msgFieldUnsupportedType, pattern.Type)))
+			invalid++
+		}
+		if err := checkLimits(pattern); err != nil {
+			fmt.Fprint(os.Stderr, msgf(msgLimitError, pattern.Name, err))
+			invalid++
+		}
+		if pattern.Type == patternTypeDictionary {
+			if _, err := loadDictionary(pattern); err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgDictionaryError, pattern.Name, err))
+				invalid++
+			}
+			continue
+		}
+		if pattern.Type == patternTypeWordlist {
+			if _, err := loadWordlist(pattern); err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgWordlistError, pattern.Name, err))
+				invalid++
+			}
+			continue
+		}
+		if pattern.Type == patternTypeHTMLRemove {
+			if _, err := parseSelector(pattern.Selector); err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgSelectorError, pattern.Name, err))
+				invalid++
+			}
+			continue
+		}
+		if _, err := compilePattern(pattern); err != nil {
+			fmt.Fprint(os.Stderr, msgf(msgRegexError, pattern.Name, err))
+			invalid++
+		}
+		if pattern.ReplaceTemplate != "" {
+			if _, err := compileReplaceTemplate(pattern, templateCounters{}); err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgTemplateError, pattern.Name, err))
+				invalid++
+			}
+		}
+	}
+	if invalid > 0 {
+		return msgErrorf(msgValidateFailed, invalid)
+	}
+	if err := checkPlaceholders(config); err != nil {
+		return err
+	}
+
+	fmt.Print(msgf(msgValidateOK, len(config.Patterns)))
+	return nil
+}
+
+func runTest(cmd command, args []string) error {
+	fs := newFlagSet(cmd)
+	configOpts := addConfigFlags(fs)
+	pattern := fs.String("pattern", "", msg(msgFlagPattern))
+	fs.StringVar(pattern, "p", "", msg(msgFlagPattern))
+	replacement := fs.String("replacement", "", msg(msgFlagReplacement))
+	vars := addVarFlag(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var config *Config
+	if *pattern != "" {
+		config = &Config{Patterns: []Pattern{{Name: "pattern", Pattern: *pattern, Replacement: *replacement}}}
+	} else {
+		config, _, err = resolveConfig(configOpts)
+		if err != nil {
+			return err
+		}
+	}
+	if err := substituteVariables(config, vars, os.LookupEnv); err != nil {
+		return err
+	}
+
+	var text string
+	if len(positional) > 0 {
+		text = strings.Join(positional, " ")
+	} else {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return msgErrorf(msgStdinReadError, err)
+		}
+		text = string(content)
+	}
+
+	printResults(extractMatches(text, config), config)
+	fmt.Println()
+	fmt.Println(msg(msgReplacedHeader))
+	fmt.Println(performReplacements(text, config))
+	return nil
+}
+
+func runConfig(cmd command, args []string) error {
+	fs := newFlagSet(cmd)
+	configOpts := addConfigFlags(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return &usageError{err: errors.New("")}
+	}
+	if positional[0] != "show" {
+		return &usageError{err: msgErrorf(msgUnknownCommand, "config "+positional[0])}
+	}
+	if len(positional) > 1 {
+		return &usageError{err: msgErrorf(msgTooManyArgs, strings.Join(positional[1:], " "))}
+	}
+
+	config, layers, err := resolveConfig(configOpts)
+	if err != nil {
+		return err
+	}
+	return writeEffectiveConfig(os.Stdout, config, layers)
+}
+
+func runPresets(cmd command, args []string) error {
+	fs := newFlagSet(cmd)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return &usageError{err: errors.New("")}
+	}
+
+	switch {
+	case positional[0] == "list" && len(positional) == 1:
+		for _, name := range presetNames() {
+			config, err := parsePreset(name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-16s %s\n", name, config.Description)
+		}
+		return nil
+	case positional[0] == "show" && len(positional) == 2:
+		data, err := readPreset(positional[1])
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	case positional[0] == "list" || positional[0] == "show":
+		fs.Usage()
+		return &usageError{err: errors.New("")}
+	}
+	return &usageError{err: msgErrorf(msgUnknownCommand, "presets "+positional[0])}
+}
+
+func runVersion(cmd command, args []string) error {
+	fs := newFlagSet(cmd)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return &usageError{err: msgErrorf(msgTooManyArgs, strings.Join(positional, " "))}
+	}
+
+	fmt.Printf("%s %s\n", programName, version)
+	return nil
+}
+
+func runHelp(_ command, args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		printUsage(os.Stderr)
+		return &usageError{err: msgErrorf(msgUnknownCommand, args[0])}
+	}
+	return cmd.run(cmd, []string{"--help"})
+}
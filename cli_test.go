@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		wantConfig     stringList
+		wantPositional []string
+		wantErr        bool
+	}{
+		{
+			name:           "flags before positional",
+			args:           []string{"--config", "a.yaml", "input.txt"},
+			wantConfig:     stringList{"a.yaml"},
+			wantPositional: []string{"input.txt"},
+		},
+		{
+			name:           "flags after positional",
+			args:           []string{"input.txt", "-c", "b.yaml"},
+			wantConfig:     stringList{"b.yaml"},
+			wantPositional: []string{"input.txt"},
+		},
+		{
+			name:           "double dash stops flag parsing",
+			args:           []string{"--config=c.yaml", "--", "-input.txt"},
+			wantConfig:     stringList{"c.yaml"},
+			wantPositional: []string{"-input.txt"},
+		},
+		{
+			name:           "repeated config",
+			args:           []string{"-c", "base.yaml", "input.txt", "--config", "override.yaml"},
+			wantConfig:     stringList{"base.yaml", "override.yaml"},
+			wantPositional: []string{"input.txt"},
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--unknown", "input.txt"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFlagSet(command{name: "extract", summary: msgCmdExtract})
+			fs.SetOutput(io.Discard)
+			configOpts := addConfigFlags(fs)
+
+			positional, err := parseFlags(fs, tt.args)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantConfig, configOpts.files)
+			require.Equal(t, tt.wantPositional, positional)
+		})
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("oldtext here"), 0644))
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "old"
+    pattern: 'oldtext'
+    replacement: 'newtext'`), 0644))
+	badConfig := filepath.Join(tmpDir, "bad.yaml")
+	require.NoError(t, os.WriteFile(badConfig, []byte(`patterns:
+  - name: "broken"
+    pattern: '[unclosed'`), 0644))
+	badTemplate := filepath.Join(tmpDir, "bad_template.yaml")
+	require.NoError(t, os.WriteFile(badTemplate, []byte(`patterns:
+  - name: "broken"
+    pattern: 'old'
+    replace_template: '{{upper'`), 0644))
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{name: "no arguments", args: []string{}, expected: exitUsage},
+		{name: "help", args: []string{"--help"}, expected: exitOK},
+		{name: "version", args: []string{"--version"}, expected: exitOK},
+		{name: "extract", args: []string{"extract", "--config", configFile, inputFile}, expected: exitOK},
+		{name: "extract is the default command", args: []string{inputFile, "-c", configFile}, expected: exitOK},
+		{name: "extract without input", args: []string{"extract", "--config", configFile}, expected: exitUsage},
+		{name: "unknown flag", args: []string{"extract", "--bogus", inputFile}, expected: exitUsage},
+		{name: "unknown command flag", args: []string{"--bogus"}, expected: exitUsage},
+		{name: "missing config", args: []string{"extract", "-c", filepath.Join(tmpDir, "none.yaml"), inputFile}, expected: exitError},
+		{name: "validate valid config", args: []string{"validate", "-c", configFile}, expected: exitOK},
+		{name: "validate invalid regex", args: []string{"validate", "-c", badConfig}, expected: exitError},
+		{name: "validate invalid template", args: []string{"validate", "-c", badTemplate}, expected: exitError},
+		{name: "test with inline pattern", args: []string{"test", "--pattern", `\d+`, "abc 123"}, expected: exitOK},
+		{name: "unknown language", args: []string{"--lang", "fr", "version"}, expected: exitUsage},
+		{name: "language before the command", args: []string{"--lang", "en", "version"}, expected: exitOK},
+		{name: "language with equals before the command", args: []string{"--lang=en", "extract", "-c", configFile, inputFile}, expected: exitOK},
+		{name: "language before the default command", args: []string{"--lang", "en", inputFile, "-c", configFile}, expected: exitOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() { currentLang = langJapanese }()
+			require.Equal(t, tt.expected, run(tt.args))
+		})
+	}
+}
+
+func TestRun_Replace(t *testing.T) {
+	defer func() { currentLang = langJapanese }()
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("oldtext here"), 0644))
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "old"
+    pattern: 'oldtext'
+    replacement: 'newtext'`), 0644))
+
+	require.Equal(t, exitOK, run([]string{"replace", "--config", configFile, inputFile}))
+
+	output, err := os.ReadFile(filepath.Join(tmpDir, "input_replaced.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "newtext here", string(output))
+}
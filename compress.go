@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// 入力ファイルの圧縮形式
+const (
+	compressionGzip  = "gzip"
+	compressionBzip2 = "bzip2"
+)
+
+// compressionExtensions は圧縮形式ごとに取り除くファイル名の拡張子と、取り除いた後に付ける拡張子
+// （.tgz は .tar にする）
+var compressionExtensions = map[string]map[string]string{
+	compressionGzip:  {".gz": "", ".gzip": "", ".tgz": ".tar"},
+	compressionBzip2: {".bz2": "", ".bzip2": "", ".tbz2": ".tar", ".tbz": ".tar"},
+}
+
+// detectCompression は先頭のマジックバイトから圧縮形式を判定する（圧縮されていなければ空文字列）
+func detectCompression(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return compressionGzip
+	case len(data) >= 4 && bytes.HasPrefix(data, []byte("BZh")) && data[3] >= '1' && data[3] <= '9':
+		return compressionBzip2
+	}
+	return ""
+}
+
+// decompress は compression の形式で圧縮された data を展開する
+func decompress(data []byte, compression string) ([]byte, error) {
+	var r io.Reader
+	switch compression {
+	case compressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, msgErrorf(msgDecompressFailed, compression, err)
+		}
+		defer zr.Close()
+		r = zr
+	case compressionBzip2:
+		r = bzip2.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, msgErrorf(msgDecompressFailed, compression, err)
+	}
+	return content, nil
+}
+
+// gzipData は data を gzip で圧縮する
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// trimCompressionExt は filename の末尾にある compression の拡張子（.gz など）を取り除く。
+// .tgz や .tbz2 は .tar にする
+func trimCompressionExt(filename, compression string) string {
+	ext := filepath.Ext(filename)
+	if replacement, ok := compressionExtensions[compression][strings.ToLower(ext)]; ok {
+		return strings.TrimSuffix(filename, ext) + replacement
+	}
+	return filename
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bzip2Log は "ERROR disk full\nINFO ok\n" を bzip2 で圧縮したもの
+const bzip2Log = "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x4b\x23\x81\x4f\x00\x00\x02\xd7\x80\x00\x10\x40\x00\x03\x21\x90\x00\x05\x2c\x8a\x00\x20\x00\x31\x4c\x00\x13\x42\x9a\x1a\x1f\xaa\x32\x7a\x9d\x82\xc6\x06\x0c\xbb\x05\x39\x3e\x84\xe9\x7c\x5d\xc9\x14\xe1\x42\x41\x2c\x8e\x05\x3c"
+
+func mustGzip(t *testing.T, text string) []byte {
+	t.Helper()
+	data, err := gzipData([]byte(text))
+	require.NoError(t, err)
+	return data
+}
+
+func TestDetectCompression(t *testing.T) {
+	require.Equal(t, compressionGzip, detectCompression(mustGzip(t, "log")))
+	require.Equal(t, compressionBzip2, detectCompression([]byte(bzip2Log)))
+	require.Equal(t, "", detectCompression([]byte("BZh is not enough")))
+	require.Equal(t, "", detectCompression([]byte("plain text")))
+	require.Equal(t, "", detectCompression(nil))
+}
+
+func TestDecompress(t *testing.T) {
+	content, err := decompress(mustGzip(t, "ERROR disk full\n"), compressionGzip)
+	require.NoError(t, err)
+	require.Equal(t, "ERROR disk full\n", string(content))
+
+	content, err = decompress([]byte(bzip2Log), compressionBzip2)
+	require.NoError(t, err)
+	require.Equal(t, "ERROR disk full\nINFO ok\n", string(content))
+
+	_, err = decompress([]byte("\x1f\x8bbroken"), compressionGzip)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "gzip の展開に失敗しました")
+}
+
+func TestTrimCompressionExt(t *testing.T) {
+	require.Equal(t, "logs/app.log", trimCompressionExt("logs/app.log.gz", compressionGzip))
+	require.Equal(t, "app.log", trimCompressionExt("app.log.BZ2", compressionBzip2))
+	require.Equal(t, "app.log", trimCompressionExt("app.log", compressionGzip))
+	require.Equal(t, "app.log.gz", trimCompressionExt("app.log.gz", ""))
+	require.Equal(t, "bundle.tar", trimCompressionExt("bundle.tgz", compressionGzip))
+	require.Equal(t, "bundle.tar", trimCompressionExt("bundle.TBZ2", compressionBzip2))
+	require.Equal(t, "bundle.tbz2", trimCompressionExt("bundle.tbz2", compressionGzip))
+}
+
+func TestRun_CompressedInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "error"
+    pattern: 'ERROR'
+    replacement: 'E'
+    when:
+      extension: [log]`), 0644))
+	gzipFile := filepath.Join(tmpDir, "app.log.gz")
+	require.NoError(t, os.WriteFile(gzipFile, mustGzip(t, "ERROR disk full\nINFO ok\n"), 0644))
+	bzip2File := filepath.Join(tmpDir, "old.log.bz2")
+	require.NoError(t, os.WriteFile(bzip2File, []byte(bzip2Log), 0644))
+
+	tests := []struct {
+		name       string
+		args       []string
+		outputFile string
+		gzipped    bool
+	}{
+		{name: "gzip to plain", args: []string{gzipFile}, outputFile: "app_replaced.log"},
+		{name: "gzip to gzip", args: []string{"--gzip", gzipFile}, outputFile: "app_replaced.log.gz", gzipped: true},
+		{name: "bzip2 to plain", args: []string{bzip2File}, outputFile: "old_replaced.log"},
+		{name: "bzip2 to gzip", args: []string{bzip2File, "--gzip"}, outputFile: "old_replaced.log.gz", gzipped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"replace", "-c", configFile}, tt.args...)
+			require.Equal(t, exitOK, run(args))
+			output, err := os.ReadFile(filepath.Join(tmpDir, tt.outputFile))
+			require.NoError(t, err)
+			if tt.gzipped {
+				require.Equal(t, compressionGzip, detectCompression(output))
+				output, err = decompress(output, compressionGzip)
+				require.NoError(t, err)
+			}
+			require.Equal(t, "E disk full\nINFO ok\n", string(output))
+		})
+	}
+
+	input, err := readInput(gzipFile)
+	require.NoError(t, err)
+	require.Equal(t, compressionGzip, input.compression)
+	require.Empty(t, input.archive)
+	require.Equal(t, filepath.Join(tmpDir, "app.log"), input.name)
+	doc, err := newDocument(input.name, input.content, &inputOptions{encoding: encodingAuto})
+	require.NoError(t, err)
+	require.Equal(t, "ERROR disk full\nINFO ok\n", doc.text)
+	require.Len(t, extractMatchesInFile(doc.text, doc.name, &Config{Patterns: []Pattern{{Name: "error", Pattern: "ERROR", When: &Condition{Extension: []string{"log"}}}}}), 1)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// configEnvVar は設定ファイルのパスを指定する環境変数
+	configEnvVar = "REGEX_EXTRACTOR_CONFIG"
+	// projectConfigName はカレントディレクトリからリポジトリのルートまで探索するファイル名
+	projectConfigName = ".regex-extractor.yaml"
+	// defaultConfigName は従来どおりカレントディレクトリで探す設定ファイル名
+	defaultConfigName = "config.yaml"
+)
+
+// 設定レイヤーの種類（優先度の低い順）
+const (
+	layerPreset  = "preset"
+	layerUser    = "user"
+	layerProject = "project"
+	layerDefault = "default"
+	layerEnv     = "env"
+	layerFlag    = "flag"
+)
+
+// configLayer は有効な設定を構成する1つの設定ファイル
+type configLayer struct {
+	kind string
+	path string
+}
+
+// stringList は繰り返し指定できる文字列フラグ
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// discoverConfigLayers は設定ファイルを優先度の低い順に列挙する。
+// ユーザー設定、プロジェクト設定（外側のディレクトリから順に）、環境変数、--config の順で、
+// 後のレイヤーほど優先される。カレントディレクトリの config.yaml は環境変数と
+// --config のどちらも指定されていない場合のみ使用する。
+func discoverConfigLayers(explicit []string, getenv func(string) string, cwd string) []configLayer {
+	var layers []configLayer
+
+	if path := userConfigPath(getenv); path != "" && fileExists(path) {
+		layers = append(layers, configLayer{kind: layerUser, path: path})
+	}
+
+	for _, path := range projectConfigPaths(cwd) {
+		layers = append(layers, configLayer{kind: layerProject, path: path})
+	}
+
+	envPath := getenv(configEnvVar)
+	if envPath == "" && len(explicit) == 0 {
+		path := filepath.Join(cwd, defaultConfigName)
+		if fileExists(path) {
+			layers = append(layers, configLayer{kind: layerDefault, path: path})
+		}
+	}
+
+	if envPath != "" {
+		layers = append(layers, configLayer{kind: layerEnv, path: envPath})
+	}
+
+	for _, path := range explicit {
+		layers = append(layers, configLayer{kind: layerFlag, path: path})
+	}
+
+	return layers
+}
+
+// userConfigPath は $XDG_CONFIG_HOME/regex-extractor/config.yaml（未設定時は ~/.config 以下）を返す
+func userConfigPath(getenv func(string) string) string {
+	base := getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, programName, defaultConfigName)
+}
+
+// projectConfigPaths はcwdから親ディレクトリへ .regex-extractor.yaml を探し、外側から順に返す。
+// .git を含むディレクトリ（リポジトリのルート）に達した時点で探索を終える
+func projectConfigPaths(cwd string) []string {
+	var paths []string
+	dir := cwd
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if fileExists(path) {
+			paths = append([]string{path}, paths...)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return paths
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// loadLayeredConfig は各レイヤーを読み込んでマージする。
+// 同じ名前のパターンは後のレイヤーの定義で置き換え（位置は最初に定義された場所を維持）、
+// 新しい名前のパターンは末尾に追加する。definitions も後のレイヤーが優先され、
+// マージ後に展開するため下位のレイヤーの定義を参照できる
+func loadLayeredConfig(layers []configLayer) (*Config, error) {
+	if len(layers) == 0 {
+		return nil, msgErrorf(msgConfigNotFound, defaultConfigName, projectConfigName, configEnvVar)
+	}
+
+	merged := &Config{Definitions: make(map[string]string)}
+	index := make(map[string]int)
+
+	for _, layer := range layers {
+		config, err := newIncludeResolver().load(layer.path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layer.path, err)
+		}
+
+		for name, body := range config.Definitions {
+			merged.Definitions[name] = body
+		}
+
+		for _, pattern := range config.Patterns {
+			if pattern.Name != "" {
+				if i, ok := index[pattern.Name]; ok {
+					merged.Patterns[i] = pattern
+					continue
+				}
+				index[pattern.Name] = len(merged.Patterns)
+			}
+			merged.Patterns = append(merged.Patterns, pattern)
+		}
+	}
+
+	if err := expandDefinitions(merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// resolveConfig は--config、--presetの指定と環境から有効な設定を組み立てる。
+// --presetで選んだプリセットは最も優先度の低いレイヤーになる。when.matched の参照の誤りはここでエラーにする
+func resolveConfig(opts *configOptions) (*Config, []configLayer, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var layers []configLayer
+	for _, name := range opts.presets {
+		layers = append(layers, configLayer{kind: layerPreset, path: presetPrefix + name})
+	}
+	layers = append(layers, discoverConfigLayers(opts.files, os.Getenv, cwd)...)
+	config, err := loadLayeredConfig(layers)
+	if err != nil {
+		return nil, nil, msgErrorf(msgConfigLoadError, err)
+	}
+	// when.matched の参照先は --only や --skip で絞り込む前の設定で確かめる
+	if err := checkConditions(config); err != nil {
+		return nil, nil, err
+	}
+	if err := opts.selection.apply(config); err != nil {
+		return nil, nil, err
+	}
+	return config, layers, nil
+}
+
+// writeEffectiveConfig はマージ後の設定を、各パターンの定義元をコメントとして付けてYAMLで出力する
+func writeEffectiveConfig(w io.Writer, config *Config, layers []configLayer) error {
+	fmt.Fprintln(w, msg(msgConfigShowLayers))
+	for _, layer := range layers {
+		fmt.Fprintf(w, "#   [%s] %s\n", layer.kind, layer.path)
+	}
+
+	if len(config.Definitions) > 0 {
+		data, err := yaml.Marshal(map[string]interface{}{"definitions": config.Definitions})
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, string(data))
+	}
+
+	if len(config.Patterns) == 0 {
+		fmt.Fprintln(w, "patterns: []")
+		return nil
+	}
+
+	fmt.Fprintln(w, "patterns:")
+	for _, pattern := range config.Patterns {
+		data, err := yaml.Marshal([]Pattern{pattern})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "  # %s\n", msgf(msgConfigShowSource, pattern.Source))
+		if pattern.Stage != "" {
+			fmt.Fprintf(w, "  # %s\n", msgf(msgConfigShowStage, pattern.Stage))
+		}
+		if pattern.Template != "" {
+			fmt.Fprintf(w, "  # %s\n", msgf(msgConfigShowTemplate, pattern.Template))
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestDiscoverConfigLayers(t *testing.T) {
+	root := t.TempDir()
+	xdg := filepath.Join(root, "xdg")
+	repo := filepath.Join(root, "repo")
+	cwd := filepath.Join(repo, "sub", "deeper")
+
+	userConfig := filepath.Join(xdg, programName, defaultConfigName)
+	writeFile(t, userConfig, "patterns: []")
+	// リポジトリの外側にある設定は探索しない
+	writeFile(t, filepath.Join(root, projectConfigName), "patterns: []")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), 0755))
+	repoConfig := filepath.Join(repo, projectConfigName)
+	writeFile(t, repoConfig, "patterns: []")
+	subConfig := filepath.Join(repo, "sub", projectConfigName)
+	writeFile(t, subConfig, "patterns: []")
+	cwdDefault := filepath.Join(cwd, defaultConfigName)
+	writeFile(t, cwdDefault, "patterns: []")
+
+	tests := []struct {
+		name     string
+		explicit []string
+		env      map[string]string
+		expected []configLayer
+	}{
+		{
+			name: "discovery without explicit config",
+			env:  map[string]string{"XDG_CONFIG_HOME": xdg},
+			expected: []configLayer{
+				{kind: layerUser, path: userConfig},
+				{kind: layerProject, path: repoConfig},
+				{kind: layerProject, path: subConfig},
+				{kind: layerDefault, path: cwdDefault},
+			},
+		},
+		{
+			name: "environment variable replaces default config.yaml",
+			env:  map[string]string{"XDG_CONFIG_HOME": xdg, configEnvVar: "/env.yaml"},
+			expected: []configLayer{
+				{kind: layerUser, path: userConfig},
+				{kind: layerProject, path: repoConfig},
+				{kind: layerProject, path: subConfig},
+				{kind: layerEnv, path: "/env.yaml"},
+			},
+		},
+		{
+			name:     "explicit flags have highest precedence",
+			explicit: []string{"a.yaml", "b.yaml"},
+			env:      map[string]string{"HOME": filepath.Join(root, "nohome"), configEnvVar: "/env.yaml"},
+			expected: []configLayer{
+				{kind: layerProject, path: repoConfig},
+				{kind: layerProject, path: subConfig},
+				{kind: layerEnv, path: "/env.yaml"},
+				{kind: layerFlag, path: "a.yaml"},
+				{kind: layerFlag, path: "b.yaml"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(name string) string { return tt.env[name] }
+			require.Equal(t, tt.expected, discoverConfigLayers(tt.explicit, getenv, cwd))
+		})
+	}
+}
+
+func TestLoadLayeredConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	base := filepath.Join(tmpDir, "base.yaml")
+	writeFile(t, base, `patterns:
+  - name: "url"
+    pattern: 'https?://\S+'
+    replacement: '[URL]'
+  - name: "ip"
+    pattern: '\d+\.\d+\.\d+\.\d+'`)
+	override := filepath.Join(tmpDir, "override.yaml")
+	writeFile(t, override, `patterns:
+  - name: "extra"
+    pattern: 'extra'
+  - name: "url"
+    pattern: 'https://\S+'
+    replacement: '<URL>'`)
+
+	config, err := loadLayeredConfig([]configLayer{
+		{kind: layerUser, path: base},
+		{kind: layerFlag, path: override},
+	})
+	require.NoError(t, err)
+	require.Len(t, config.Patterns, 3)
+	for i, want := range []struct{ name, pattern, replacement, source string }{
+		{name: "url", pattern: `https://\S+`, replacement: "<URL>", source: override},
+		{name: "ip", pattern: `\d+\.\d+\.\d+\.\d+`, source: base},
+		{name: "extra", pattern: "extra", source: override},
+	} {
+		got := config.Patterns[i]
+		require.Equal(t, want.name, got.Name)
+		require.Equal(t, want.pattern, got.Pattern)
+		require.Equal(t, want.replacement, got.Replacement)
+		require.Equal(t, want.source, got.Source)
+	}
+
+	var out strings.Builder
+	require.NoError(t, writeEffectiveConfig(&out, config, []configLayer{{kind: layerFlag, path: override}}))
+	require.Contains(t, out.String(), "# 定義元: "+override)
+	require.Contains(t, out.String(), "  - name: url\n")
+
+	_, err = loadLayeredConfig(nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "設定ファイルが見つかりません")
+}
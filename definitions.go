@@ -0,0 +1,74 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxDefinitionDepth は definitions が別の定義を参照できる段数の上限
+const maxDefinitionDepth = 10
+
+// definitionRef はパターン中の {{名前}} 参照
+var definitionRef = regexp.MustCompile(`\{\{([A-Za-z_][A-Za-z0-9_-]*)\}\}`)
+
+// expandDefinitions は各パターンの {{名前}} を definitions の内容で置き換える。
+// 展開した場合は元のパターンを Template に残す
+func expandDefinitions(config *Config) error {
+	for i := range config.Patterns {
+		pattern := &config.Patterns[i]
+		if pattern.Type == patternTypeLiteral {
+			// literal は {{ }} も含めてそのままの文字列として扱う
+			continue
+		}
+		expanded, err := expandReferences(pattern.Pattern, config.Definitions, nil)
+		if err != nil {
+			return msgErrorf(msgPatternExpandError, pattern.Name, err)
+		}
+		if expanded != pattern.Pattern {
+			pattern.Template = pattern.Pattern
+			pattern.Pattern = expanded
+		}
+	}
+	return nil
+}
+
+// expandReferences は s に含まれる参照を再帰的に展開する。
+// 定義の中の | が周囲に影響しないよう、展開結果は (?:...) で囲む
+func expandReferences(s string, definitions map[string]string, stack []string) (string, error) {
+	var expandErr error
+	result := definitionRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if expandErr != nil {
+			return ref
+		}
+
+		name := definitionRef.FindStringSubmatch(ref)[1]
+		for i, parent := range stack {
+			if parent == name {
+				chain := append(append([]string{}, stack[i:]...), name)
+				expandErr = msgErrorf(msgDefinitionCycle, strings.Join(chain, " -> "))
+				return ref
+			}
+		}
+		if len(stack) >= maxDefinitionDepth {
+			expandErr = msgErrorf(msgDefinitionTooDeep, maxDefinitionDepth, strings.Join(append(stack, name), " -> "))
+			return ref
+		}
+
+		body, ok := definitions[name]
+		if !ok {
+			expandErr = msgErrorf(msgDefinitionUndefined, name)
+			return ref
+		}
+
+		expanded, err := expandReferences(body, definitions, append(append([]string{}, stack...), name))
+		if err != nil {
+			expandErr = err
+			return ref
+		}
+		return "(?:" + expanded + ")"
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return result, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandReferences(t *testing.T) {
+	definitions := map[string]string{
+		"date":      `\d{4}-\d{2}-\d{2}`,
+		"time":      `\d{2}:\d{2}`,
+		"datetime":  `{{date}} {{time}}`,
+		"bracket":   `『([^』\n]*)』`,
+		"yes_or_no": `yes|no`,
+		"loop_a":    `a{{loop_b}}`,
+		"loop_b":    `b{{loop_a}}`,
+	}
+
+	tests := []struct {
+		name        string
+		pattern     string
+		expected    string
+		errContains string
+	}{
+		{
+			name:     "no references",
+			pattern:  `plain \d+`,
+			expected: `plain \d+`,
+		},
+		{
+			name:     "single reference",
+			pattern:  `TITLE: {{bracket}}`,
+			expected: `TITLE: (?:『([^』\n]*)』)`,
+		},
+		{
+			name:     "nested references",
+			pattern:  `at {{datetime}}`,
+			expected: `at (?:(?:\d{4}-\d{2}-\d{2}) (?:\d{2}:\d{2}))`,
+		},
+		{
+			name:     "alternation is grouped",
+			pattern:  `answer: {{yes_or_no}}!`,
+			expected: `answer: (?:yes|no)!`,
+		},
+		{
+			name:     "regex quantifiers are not references",
+			pattern:  `a{2}b{1,3}`,
+			expected: `a{2}b{1,3}`,
+		},
+		{
+			name:        "undefined name",
+			pattern:     `{{missing}}`,
+			errContains: "未定義の名前を参照しています: {{missing}}",
+		},
+		{
+			name:        "cycle",
+			pattern:     `{{loop_a}}`,
+			errContains: "loop_a -> loop_b -> loop_a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandReferences(tt.pattern, definitions, nil)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestExpandReferences_DepthLimit(t *testing.T) {
+	definitions := make(map[string]string)
+	for i := 0; i <= maxDefinitionDepth; i++ {
+		definitions[fmt.Sprintf("d%d", i)] = fmt.Sprintf("{{d%d}}", i+1)
+	}
+	definitions[fmt.Sprintf("d%d", maxDefinitionDepth+1)] = "x"
+
+	_, err := expandReferences("{{d0}}", definitions, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "展開が深すぎます")
+}
+
+func TestLoadConfig_Definitions(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFile(t, filepath.Join(tmpDir, "common.yaml"), `definitions:
+  date: '\d{4}/\d{1,2}/\d{1,2}'
+  bracket: '『([^』\n]*)』'
+patterns: []`)
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configFile, `include:
+  - common.yaml
+definitions:
+  date: '\d{4}-\d{2}-\d{2}'
+patterns:
+  - name: "title"
+    pattern: 'TITLE: {{bracket}}'
+    replacement: 'TITLE: $1'
+  - name: "date"
+    pattern: '{{date}}'
+    replacement: '[DATE]'`)
+
+	config, err := loadConfig(configFile)
+	require.NoError(t, err)
+	require.Equal(t, `TITLE: (?:『([^』\n]*)』)`, config.Patterns[0].Pattern)
+	require.Equal(t, `TITLE: {{bracket}}`, config.Patterns[0].Template)
+
+	result := performReplacements("TITLE: 『見出し』 2024-01-15 2024/1/15", config)
+	require.Equal(t, "TITLE: 見出し [DATE] 2024/1/15", result)
+
+	var out strings.Builder
+	require.NoError(t, writeEffectiveConfig(&out, config, nil))
+	require.Contains(t, out.String(), "# 展開前: TITLE: {{bracket}}")
+
+	writeFile(t, configFile, `patterns:
+  - name: "broken"
+    pattern: '{{nothing}}'`)
+	_, err = loadConfig(configFile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "パターン 'broken' の展開に失敗")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// パターンの種類（type）
+const (
+	patternTypeRegex      = "regex"
+	patternTypeLiteral    = "literal"
+	patternTypeWordlist   = "wordlist"
+	patternTypeDictionary = "dictionary"
+	patternTypeHTMLRemove = "html-remove"
+)
+
+// dictionary は type: dictionary のパターンで使う置換表
+type dictionary struct {
+	matcher *ahoCorasick
+	entries map[string]string
+}
+
+// dictionaryHit は辞書のエントリごとの置換件数
+type dictionaryHit struct {
+	Key   string
+	Value string
+	Count int
+}
+
+// loadDictionary はパターンの dictionary に指定されたファイルを読み込む
+func loadDictionary(pattern Pattern) (*dictionary, error) {
+	if pattern.Dictionary == "" {
+		return nil, msgErrorf(msgDictionaryMissing, pattern.Name)
+	}
+	entries, err := readDictionaryFile(pattern.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+	return newDictionary(entries, pattern.WholeWord), nil
+}
+
+func newDictionary(entries map[string]string, wholeWord bool) *dictionary {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	return &dictionary{matcher: newAhoCorasick(keys, wholeWord), entries: entries}
+}
+
+// readDictionaryFile は拡張子に応じて CSV、TSV、YAML の置換表を読み込む。
+// CSV と TSV は1列目をキー、2列目を値とし、# で始まる行はコメントとして読み飛ばす
+func readDictionaryFile(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, msgErrorf(msgDictionaryReadError, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return parseDictionaryCSV(filename, data)
+	case ".tsv", ".tab":
+		return parseDictionaryTSV(filename, data)
+	case ".yaml", ".yml":
+		var entries map[string]string
+		if err := yaml.UnmarshalStrict(data, &entries); err != nil {
+			return nil, msgErrorf(msgYAMLParseError, err)
+		}
+		// 空のキーはどこにもマッチしないため取り除く
+		delete(entries, "")
+		return entries, nil
+	}
+	return nil, msgErrorf(msgDictionaryFormat, filename)
+}
+
+func parseDictionaryCSV(filename string, data []byte) (map[string]string, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), "\ufeff")))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	entries := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, msgErrorf(msgDictionaryReadError, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 2 {
+			return nil, msgErrorf(msgDictionaryColumns, filename, line)
+		}
+		key := record[0]
+		if key == "" {
+			return nil, msgErrorf(msgDictionaryEmptyKey, filename, line)
+		}
+		if _, ok := entries[key]; ok {
+			return nil, msgErrorf(msgDictionaryDuplicateKey, filename, line, key)
+		}
+		entries[key] = record[1]
+	}
+	return entries, nil
+}
+
+// parseDictionaryTSV はタブ区切りの置換表を読み込む。CSV と違い引用符は通常の文字として扱う
+func parseDictionaryTSV(filename string, data []byte) (map[string]string, error) {
+	entries := make(map[string]string)
+	lines := strings.Split(strings.TrimPrefix(string(data), "\ufeff"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, msgErrorf(msgDictionaryColumns, filename, i+1)
+		}
+		if key == "" {
+			return nil, msgErrorf(msgDictionaryEmptyKey, filename, i+1)
+		}
+		if _, ok := entries[key]; ok {
+			return nil, msgErrorf(msgDictionaryDuplicateKey, filename, i+1, key)
+		}
+		value, _, _ = strings.Cut(value, "\t")
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+// replaceLocations は matcher.findAll で求めた locs の各キーを値に置き換え、エントリごとの件数を返す。
+// escape を指定した場合は値をエスケープしてから書き込む
+func (d *dictionary) replaceLocations(text string, locs [][]int, escape func(string) string) (string, map[string]int) {
+	hits := make(map[string]int)
+	if len(locs) == 0 {
+		return text, hits
+	}
+
+	var b strings.Builder
+	prev := 0
+	for _, loc := range locs {
+		key := text[loc[0]:loc[1]]
+		hits[key]++
+		b.WriteString(text[prev:loc[0]])
+		value := d.entries[key]
+		if escape != nil {
+			value = escape(value)
+		}
+		b.WriteString(value)
+		prev = loc[1]
+	}
+	b.WriteString(text[prev:])
+	return b.String(), hits
+}
+
+// sortedHits は件数の多い順（同数はキーの順）にエントリごとの件数を並べる
+func (d *dictionary) sortedHits(hits map[string]int) []dictionaryHit {
+	result := make([]dictionaryHit, 0, len(hits))
+	for key, count := range hits {
+		result = append(result, dictionaryHit{Key: key, Value: d.entries[key], Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDictionary_Replace(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   map[string]string
+		wholeWord bool
+		scope     *Scope
+		target    string
+		text      string
+		expected  string
+		hits      map[string]int
+	}{
+		{
+			name:     "longest match first",
+			entries:  map[string]string{"Go": "Golang", "Gopher": "ゴーファー", "Gopher君": "ゴーファーくん"},
+			text:     "Go と Gopher と Gopher君",
+			expected: "Golang と ゴーファー と ゴーファーくん",
+			hits:     map[string]int{"Go": 1, "Gopher": 1, "Gopher君": 1},
+		},
+		{
+			name:     "japanese typos",
+			entries:  map[string]string{"シュミレーション": "シミュレーション", "コミニュケーション": "コミュニケーション"},
+			text:     "シュミレーションとコミニュケーションとシュミレーション",
+			expected: "シミュレーションとコミュニケーションとシミュレーション",
+			hits:     map[string]int{"シュミレーション": 2, "コミニュケーション": 1},
+		},
+		{
+			name:     "replacements are not chained",
+			entries:  map[string]string{"A": "B", "B": "C"},
+			text:     "A B",
+			expected: "B C",
+			hits:     map[string]int{"A": 1, "B": 1},
+		},
+		{
+			name:     "values are literal",
+			entries:  map[string]string{"price": "$1"},
+			text:     "price",
+			expected: "$1",
+			hits:     map[string]int{"price": 1},
+		},
+		{
+			name:      "whole word",
+			entries:   map[string]string{"cat": "dog"},
+			wholeWord: true,
+			text:      "cat category bobcat cat_x (cat)",
+			expected:  "dog category bobcat cat_x (dog)",
+			hits:      map[string]int{"cat": 2},
+		},
+		{
+			name:      "whole word falls back to shorter key",
+			entries:   map[string]string{"New": "新", "New York": "ニューヨーク"},
+			wholeWord: true,
+			text:      "New Yorker",
+			expected:  "新 Yorker",
+			hits:      map[string]int{"New": 1},
+		},
+		{
+			name:     "values are escaped in HTML text",
+			entries:  map[string]string{"B": "<b>B</b>"},
+			target:   "text",
+			text:     `<a title="B">B</a>`,
+			expected: `<a title="B">&lt;b&gt;B&lt;/b&gt;</a>`,
+			hits:     map[string]int{"B": 1},
+		},
+		{
+			name:     "scope",
+			entries:  map[string]string{"foo": "bar"},
+			scope:    &Scope{Outside: "`[^`]*`"},
+			text:     "foo `foo` foo",
+			expected: "bar `foo` bar",
+			hits:     map[string]int{"foo": 2},
+		},
+		{
+			name:     "no match",
+			entries:  map[string]string{"foo": "bar"},
+			text:     "nothing here",
+			expected: "nothing here",
+			hits:     map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dict := newDictionary(tt.entries, tt.wholeWord)
+			pattern := Pattern{Name: "dict", Type: patternTypeDictionary, Scope: tt.scope, Target: tt.target}
+			locs, err := findInSegments(pattern, tt.text, dict.matcher.findAll, 0)
+			require.NoError(t, err)
+			result, hits := dict.replaceLocations(tt.text, locs, pattern.escapeReplacement)
+			require.Equal(t, tt.expected, result)
+			require.Equal(t, tt.hits, hits)
+		})
+	}
+}
+
+func TestDictionary_SortedHits(t *testing.T) {
+	dict := newDictionary(map[string]string{"a": "1", "b": "2", "c": "3"}, false)
+	hits := dict.sortedHits(map[string]int{"a": 1, "b": 3, "c": 1})
+	require.Equal(t, []dictionaryHit{
+		{Key: "b", Value: "2", Count: 3},
+		{Key: "a", Value: "1", Count: 1},
+		{Key: "c", Value: "3", Count: 1},
+	}, hits)
+}
+
+func TestReadDictionaryFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		expected    map[string]string
+		errContains string
+	}{
+		{
+			name:     "csv with comments and quotes",
+			file:     "table.csv",
+			content:  "\ufeff# 旧名,新名\n旧製品A,新製品A\n\"Foo, Inc.\",\"Bar, Inc.\"\n削除,\n",
+			expected: map[string]string{"旧製品A": "新製品A", "Foo, Inc.": "Bar, Inc.", "削除": ""},
+		},
+		{
+			name:     "tsv",
+			file:     "table.tsv",
+			content:  "誤字\t誤記\n\"引用\"\t引用\n",
+			expected: map[string]string{"誤字": "誤記", `"引用"`: "引用"},
+		},
+		{
+			name:     "yaml",
+			file:     "table.yaml",
+			content:  "旧製品A: 新製品A\nold: new\n",
+			expected: map[string]string{"旧製品A": "新製品A", "old": "new"},
+		},
+		{
+			name:        "missing value column",
+			file:        "columns.csv",
+			content:     "a,b\nc\n",
+			errContains: "columns.csv:2: キーと値の2列が必要です",
+		},
+		{
+			name:        "empty key",
+			file:        "empty.csv",
+			content:     ",b\n",
+			errContains: "empty.csv:1: キーが空です",
+		},
+		{
+			name:        "duplicate key",
+			file:        "duplicate.csv",
+			content:     "a,b\nx,y\na,c\n",
+			errContains: "duplicate.csv:3: キー 'a' が重複しています",
+		},
+		{
+			name:        "unknown format",
+			file:        "table.txt",
+			content:     "a,b\n",
+			errContains: "置換表の形式を判別できません",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, tt.file)
+			writeFile(t, path, tt.content)
+			entries, err := readDictionaryFile(path)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, entries)
+		})
+	}
+}
+
+func TestLoadConfig_Dictionary(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFile(t, filepath.Join(tmpDir, "tables", "products.csv"), "旧製品A,新製品A\n旧製品,新製品\n")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configFile, `patterns:
+  - name: "products"
+    type: dictionary
+    dictionary: tables/products.csv
+  - name: "version"
+    pattern: 'v(\d+)'
+    replacement: 'version $1'`)
+
+	config, err := loadConfig(configFile)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(tmpDir, "tables", "products.csv"), config.Patterns[0].Dictionary)
+
+	text := "旧製品A v2\n旧製品 と 旧製品A"
+	require.Equal(t, "新製品A version 2\n新製品 と 新製品A", performReplacements(text, config))
+
+	matches := extractMatches(text, config)
+	require.Len(t, matches, 4)
+	require.Equal(t, Match{PatternName: "products", Line: 2, Text: "旧製品", Matches: []string{"旧製品"}}, matches[1])
+
+	config.Patterns[0].Dictionary = filepath.Join(tmpDir, "missing.csv")
+	require.Equal(t, "旧製品A version 2", performReplacements("旧製品A v2", config))
+}
+
+func TestPattern_IsEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  Pattern
+		expected bool
+	}{
+		{name: "no type", pattern: Pattern{}, expected: true},
+		{name: "regex", pattern: Pattern{Type: patternTypeRegex}, expected: true},
+		{name: "literal", pattern: Pattern{Type: patternTypeLiteral}, expected: true},
+		{name: "regex with pattern", pattern: Pattern{Type: patternTypeRegex, Pattern: "a"}},
+		{name: "wordlist", pattern: Pattern{Type: patternTypeWordlist}},
+		{name: "dictionary", pattern: Pattern{Type: patternTypeDictionary}},
+		{name: "html-remove", pattern: Pattern{Type: patternTypeHTMLRemove}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.pattern.isEmpty())
+		})
+	}
+}
+
+func TestPerformReplacements_EmptyPatternWithType(t *testing.T) {
+	for _, patternType := range []string{patternTypeRegex, patternTypeLiteral} {
+		t.Run(patternType, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{{Name: "blank", Type: patternType, Replacement: "X"}}}
+			require.Equal(t, "abc", performReplacements("abc", config))
+		})
+	}
+}
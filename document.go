@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// utf8BOM は UTF-8 の BOM
+const utf8BOM = "\xef\xbb\xbf"
+
+// inputOptions は入力ファイルの読み込み方に関するコマンドラインオプション
+type inputOptions struct {
+	encoding string
+	// normalizeNewlines は CRLF を LF にしてから照合し、書き戻すときに CRLF に戻すかどうか
+	normalizeNewlines bool
+	// binary はバイナリファイルの扱い（skip、text、error）
+	binary string
+}
+
+// addInputFlags は入力ファイルの読み込み方を指定する --encoding、--normalize-newlines、--binary を登録する
+func addInputFlags(fs *flag.FlagSet) *inputOptions {
+	opts := &inputOptions{}
+	fs.StringVar(&opts.encoding, "encoding", encodingAuto, msg(msgFlagEncoding))
+	fs.BoolVar(&opts.normalizeNewlines, "normalize-newlines", false, msg(msgFlagNormalizeNewlines))
+	fs.StringVar(&opts.binary, "binary", binarySkip, msg(msgFlagBinary))
+	return opts
+}
+
+// check はオプションの値を確かめて正規化する
+func (o *inputOptions) check() error {
+	encoding, err := normalizeEncoding(o.encoding, encodingAuto)
+	if err != nil {
+		return &usageError{err: err}
+	}
+	o.encoding = encoding
+	switch o.binary {
+	case binarySkip, binaryText, binaryError:
+	default:
+		return &usageError{err: msgErrorf(msgUnknownBinaryMode, o.binary)}
+	}
+	return nil
+}
+
+// inputData は読み込んで展開した入力ファイルの内容
+type inputData struct {
+	// path はコマンドラインで指定したファイルのパス
+	path string
+	// name は path から圧縮形式の拡張子（.gz など）を除いたもの
+	name    string
+	content []byte
+	// compression は元のファイルの圧縮形式（gzip、bzip2。圧縮されていなければ空文字列）
+	compression string
+	// archive は content のアーカイブ形式（zip、tar。アーカイブでなければ空文字列）
+	archive string
+}
+
+// readInput は filename を読み込み、gzip と bzip2 で圧縮されていれば展開する
+func readInput(filename string) (*inputData, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, msgErrorf(msgFileReadError, err)
+	}
+
+	compression := detectCompression(content)
+	if compression != "" {
+		if content, err = decompress(content, compression); err != nil {
+			return nil, err
+		}
+	}
+	return &inputData{
+		path:        filename,
+		name:        trimCompressionExt(filename, compression),
+		content:     content,
+		compression: compression,
+		archive:     detectArchive(content),
+	}, nil
+}
+
+// outputFileName は置換結果を保存するファイル名を返す。
+// 圧縮されたファイルは展開したファイルの名前を元にし、gzip で保存する場合は .gz を付ける
+func (in *inputData) outputFileName(compress bool) string {
+	name := generateOutputFileName(in.name)
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// document は入力ファイル（またはアーカイブのエントリ）を UTF-8 にした内容と、書き戻すときに使う元の形式
+type document struct {
+	text string
+	// name は when.extension の判定と表示に使う名前
+	name     string
+	encoding string
+	// bom は元のファイルが UTF-8 の BOM で始まっていたかどうか（text には含めない）
+	bom bool
+	// crlf は元のファイルの改行が主に CRLF だったかどうか
+	crlf bool
+	// normalized は text の CRLF を LF にしたかどうか
+	normalized bool
+	// crlfLines は CRLF を LF にした場合に、元のファイルで各行（0 から数える）の改行が CRLF だったかどうか
+	crlfLines []bool
+}
+
+// newDocument は content を文字コード（auto なら推定したもの）から UTF-8 に変換する。
+// BOM は取り除いて記録し、--normalize-newlines が指定されていれば CRLF を LF にして CRLF だった行を記録する
+func newDocument(name string, content []byte, opts *inputOptions) (*document, error) {
+	encoding := opts.encoding
+	if encoding == encodingAuto {
+		encoding = detectEncoding(content)
+		if encoding != encodingUTF8 {
+			fmt.Fprint(os.Stderr, msgf(msgDetectedEncoding, name, encoding))
+		}
+	}
+	doc := &document{name: name, encoding: encoding}
+	if encoding == encodingUTF8 && bytes.HasPrefix(content, []byte(utf8BOM)) {
+		doc.bom = true
+		content = content[len(utf8BOM):]
+	}
+
+	text, err := decodeText(content, encoding)
+	if err != nil {
+		return nil, err
+	}
+	doc.crlf = isCRLF(text)
+	if opts.normalizeNewlines && strings.Contains(text, "\r\n") {
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if strings.HasSuffix(line, "\n") {
+				doc.crlfLines = append(doc.crlfLines, strings.HasSuffix(line, "\r\n"))
+			}
+		}
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		doc.normalized = true
+	}
+	doc.text = text
+	return doc, nil
+}
+
+// isCRLF は text の改行に CRLF が LF だけのものより多く使われているかどうかを返す
+func isCRLF(text string) bool {
+	crlf := strings.Count(text, "\r\n")
+	return crlf > 0 && crlf >= strings.Count(text, "\n")-crlf
+}
+
+// encode は置換後の text を outputEncoding（same なら読み込んだときの文字コード）のバイト列にする。
+// 改行を LF にして照合した場合は元のファイルで CRLF だった行を CRLF に戻し、
+// 元のファイルに BOM があれば（UTF-8 で書き出す場合）付け直す
+func (d *document) encode(text, outputEncoding string) ([]byte, error) {
+	if outputEncoding == encodingSame {
+		outputEncoding = d.encoding
+	}
+	if d.normalized {
+		text = d.restoreCRLF(text)
+	}
+	data, err := encodeText(text, outputEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if d.bom && outputEncoding == encodingUTF8 {
+		data = append([]byte(utf8BOM), data...)
+	}
+	return data, nil
+}
+
+// restoreCRLF は text の各行の改行を、対応する元の行が CRLF だった場合に CRLF にする。
+// 元の text と先頭から一致する行と末尾から一致する行はそのまま対応付け、間の書き換えた行は先頭から順に対応付ける。
+// 元のファイルにない行は、元のファイルで多く使われていた改行にする
+func (d *document) restoreCRLF(text string) string {
+	original := strings.SplitAfter(d.text, "\n")
+	lines := strings.SplitAfter(text, "\n")
+	prefix := 0
+	for prefix < len(original) && prefix < len(lines) && original[prefix] == lines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(original)-prefix && suffix < len(lines)-prefix &&
+		original[len(original)-1-suffix] == lines[len(lines)-1-suffix] {
+		suffix++
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "\n") {
+			b.WriteString(line)
+			continue
+		}
+		j := i
+		if i >= len(lines)-suffix {
+			j = len(original) - (len(lines) - i)
+		} else if i >= prefix && j >= len(original)-suffix {
+			j = -1
+		}
+		crlf := d.crlf
+		if j >= 0 && j < len(d.crlfLines) {
+			crlf = d.crlfLines[j]
+		}
+		if crlf && !strings.HasSuffix(line, "\r\n") {
+			line = line[:len(line)-1] + "\r\n"
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
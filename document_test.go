@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsCRLF(t *testing.T) {
+	require.False(t, isCRLF("a\nb\n"))
+	require.False(t, isCRLF("no newline"))
+	require.True(t, isCRLF("a\r\nb\r\n"))
+	require.True(t, isCRLF("a\r\nb\r\nc\n"))
+	require.False(t, isCRLF("a\r\nb\nc\n"))
+}
+
+func TestNewDocument_BOMAndNewlines(t *testing.T) {
+	inputFile := filepath.Join(t.TempDir(), "windows.txt")
+	content := "\ufeffTITLE: a\r\nCATEGORY: Test\r\nbody\r\n"
+	require.NoError(t, os.WriteFile(inputFile, []byte(content), 0644))
+
+	tests := []struct {
+		name         string
+		opts         inputOptions
+		expectedText string
+		normalized   bool
+	}{
+		{
+			name:         "keep newlines",
+			opts:         inputOptions{encoding: encodingAuto},
+			expectedText: "TITLE: a\r\nCATEGORY: Test\r\nbody\r\n",
+		},
+		{
+			name:         "normalize newlines",
+			opts:         inputOptions{encoding: encodingUTF8, normalizeNewlines: true},
+			expectedText: "TITLE: a\nCATEGORY: Test\nbody\n",
+			normalized:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := readInput(inputFile)
+			require.NoError(t, err)
+			require.Empty(t, input.archive)
+			doc, err := newDocument(input.name, input.content, &tt.opts)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedText, doc.text)
+			require.True(t, doc.bom)
+			require.True(t, doc.crlf)
+			require.Equal(t, tt.normalized, doc.normalized)
+
+			// BOM は最初のマッチに含まれない
+			matches := extractMatches(doc.text, &Config{Patterns: []Pattern{{Name: "title", Pattern: `^TITLE: \w`}}})
+			require.Len(t, matches, 1)
+			require.Equal(t, "TITLE: a", matches[0].Text)
+
+			// 置換しなければ元のファイルと同じバイト列に戻る
+			output, err := doc.encode(doc.text, encodingSame)
+			require.NoError(t, err)
+			require.Equal(t, content, string(output))
+		})
+	}
+}
+
+func TestDocument_Encode(t *testing.T) {
+	doc := &document{encoding: encodingUTF8, bom: true, crlf: true, normalized: true}
+
+	output, err := doc.encode("a\nb\n", encodingSame)
+	require.NoError(t, err)
+	require.Equal(t, "\ufeffa\r\nb\r\n", string(output))
+
+	// UTF-8 以外で書き出す場合は BOM を付けない
+	output, err = doc.encode("あ\n", encodingShiftJIS)
+	require.NoError(t, err)
+	require.Equal(t, append(mustEncode(t, "あ", encodingShiftJIS), '\r', '\n'), output)
+}
+
+func TestDocument_MixedNewlines(t *testing.T) {
+	config, err := loadConfig("testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "unchanged",
+			content:  "a\r\nb\r\nc\n",
+			expected: "a\r\nb\r\nc\n",
+		},
+		{
+			name:     "mostly CRLF keeps LF lines",
+			content:  "TITLE: x\r\nCATEGORY: Test\r\nEND\r\nc\n",
+			expected: "TITLE: x\r\nEND\r\nc\n",
+		},
+		{
+			name:     "mostly LF normalizes CRLF lines",
+			content:  "TITLE: x\nCATEGORY: Test\r\nEND\nc\n",
+			expected: "TITLE: x\nEND\nc\n",
+		},
+		{
+			name:     "edited line keeps its ending",
+			content:  "a\nTITLE: x『y』\r\nb\n",
+			expected: "a\nTITLE: xy\r\nb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := newDocument("mixed.txt", []byte(tt.content), &inputOptions{encoding: encodingUTF8, normalizeNewlines: true})
+			require.NoError(t, err)
+			require.NotContains(t, doc.text, "\r")
+
+			output, err := doc.encode(performReplacements(doc.text, config), encodingSame)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(output))
+		})
+	}
+}
+
+func TestRun_ReplaceCRLF(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("\ufeffTITLE: x\r\nCATEGORY: Test\r\nEND\r\n"), 0644))
+	outputFile := filepath.Join(tmpDir, "input_replaced.txt")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "without normalization the pattern does not match",
+			expected: "\ufeffTITLE: x\r\nCATEGORY: Test\r\nEND\r\n",
+		},
+		{
+			name:     "normalized",
+			args:     []string{"--normalize-newlines"},
+			expected: "\ufeffTITLE: x\r\nEND\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(outputFile)
+			args := append([]string{"replace", "-c", "testdata/test_config.yaml", inputFile}, tt.args...)
+			require.Equal(t, exitOK, run(args))
+			output, err := os.ReadFile(outputFile)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(output))
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// 入力ファイルの文字コード（--encoding、--output-encoding）
+const (
+	encodingAuto     = "auto"
+	encodingSame     = "same"
+	encodingUTF8     = "utf-8"
+	encodingShiftJIS = "shift_jis"
+	encodingEUCJP    = "euc-jp"
+)
+
+// encodingAliases は --encoding や meta charset で受け付ける別名（小文字）
+var encodingAliases = map[string]string{
+	"utf-8":       encodingUTF8,
+	"utf8":        encodingUTF8,
+	"shift_jis":   encodingShiftJIS,
+	"shift-jis":   encodingShiftJIS,
+	"sjis":        encodingShiftJIS,
+	"x-sjis":      encodingShiftJIS,
+	"cp932":       encodingShiftJIS,
+	"windows-31j": encodingShiftJIS,
+	"ms_kanji":    encodingShiftJIS,
+	"euc-jp":      encodingEUCJP,
+	"eucjp":       encodingEUCJP,
+	"euc_jp":      encodingEUCJP,
+	"x-euc-jp":    encodingEUCJP,
+	"ujis":        encodingEUCJP,
+}
+
+// metaCharset は HTML の <meta charset="..."> と <meta http-equiv="Content-Type" content="...; charset=..."> にマッチする
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]*?charset\s*=\s*["']?\s*([A-Za-z0-9_.:-]+)`)
+
+// metaCharsetLimit は meta charset を探すファイル先頭のバイト数
+const metaCharsetLimit = 4096
+
+// normalizeEncoding は文字コード名を正規化する。allowed に含まれる特別な名前（auto、same）もそのまま返す
+func normalizeEncoding(name string, allowed ...string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, special := range allowed {
+		if name == special {
+			return name, nil
+		}
+	}
+	if enc, ok := encodingAliases[name]; ok {
+		return enc, nil
+	}
+	return "", msgErrorf(msgUnknownEncoding, name)
+}
+
+// textEncoding は文字コードの変換器を返す（UTF-8 は変換しないため nil）
+func textEncoding(name string) encoding.Encoding {
+	switch name {
+	case encodingShiftJIS:
+		return japanese.ShiftJIS
+	case encodingEUCJP:
+		return japanese.EUCJP
+	}
+	return nil
+}
+
+// detectEncoding は BOM、UTF-8 として正しいかどうか、HTML の meta charset、
+// バイト列の特徴の順に data の文字コードを推定する
+func detectEncoding(data []byte) string {
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) || utf8.Valid(data) {
+		return encodingUTF8
+	}
+
+	head := data
+	if len(head) > metaCharsetLimit {
+		head = head[:metaCharsetLimit]
+	}
+	if m := metaCharset.FindSubmatch(head); m != nil {
+		if enc, err := normalizeEncoding(string(m[1])); err == nil && enc != encodingUTF8 {
+			return enc
+		}
+	}
+
+	sjisErrors, halfwidthKana := scanShiftJIS(data)
+	eucErrors := scanEUCJP(data)
+	switch {
+	case sjisErrors < eucErrors:
+		return encodingShiftJIS
+	case eucErrors < sjisErrors:
+		return encodingEUCJP
+	case halfwidthKana > 0:
+		// EUC-JP のかな漢字は Shift_JIS では半角カナの並びとしても読めてしまうため、
+		// 半角カナが現れる場合は EUC-JP とみなす
+		return encodingEUCJP
+	default:
+		return encodingShiftJIS
+	}
+}
+
+// scanShiftJIS は data を Shift_JIS として読んだときの不正なバイトの数と半角カナの数を返す
+func scanShiftJIS(data []byte) (errors, halfwidthKana int) {
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b < 0x80:
+		case b >= 0xa1 && b <= 0xdf:
+			halfwidthKana++
+		case (b >= 0x81 && b <= 0x9f) || (b >= 0xe0 && b <= 0xfc):
+			if i+1 < len(data) && isShiftJISTrail(data[i+1]) {
+				i++
+			} else {
+				errors++
+			}
+		default:
+			errors++
+		}
+	}
+	return errors, halfwidthKana
+}
+
+func isShiftJISTrail(b byte) bool {
+	return (b >= 0x40 && b <= 0x7e) || (b >= 0x80 && b <= 0xfc)
+}
+
+// scanEUCJP は data を EUC-JP として読んだときの不正なバイトの数を返す
+func scanEUCJP(data []byte) int {
+	errors := 0
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b < 0x80:
+		case b == 0x8e: // 半角カナ
+			if i+1 < len(data) && data[i+1] >= 0xa1 && data[i+1] <= 0xdf {
+				i++
+			} else {
+				errors++
+			}
+		case b == 0x8f: // 補助漢字
+			if i+2 < len(data) && isEUCByte(data[i+1]) && isEUCByte(data[i+2]) {
+				i += 2
+			} else {
+				errors++
+			}
+		case isEUCByte(b):
+			if i+1 < len(data) && isEUCByte(data[i+1]) {
+				i++
+			} else {
+				errors++
+			}
+		default:
+			errors++
+		}
+	}
+	return errors
+}
+
+func isEUCByte(b byte) bool {
+	return b >= 0xa1 && b <= 0xfe
+}
+
+// decodeText は name の文字コードの data を UTF-8 の文字列にする。変換できないバイトは U+FFFD になる
+func decodeText(data []byte, name string) (string, error) {
+	enc := textEncoding(name)
+	if enc == nil {
+		return string(data), nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", msgErrorf(msgDecodeFailed, name, err)
+	}
+	return string(decoded), nil
+}
+
+// encodeText は UTF-8 の text を name の文字コードに変換する。
+// その文字コードで表せない文字があればエラーにする
+func encodeText(text, name string) ([]byte, error) {
+	enc := textEncoding(name)
+	if enc == nil {
+		return []byte(text), nil
+	}
+	encoded, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		return nil, msgErrorf(msgEncodeFailed, name, err)
+	}
+	return encoded, nil
+}
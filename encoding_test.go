@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func mustEncode(t *testing.T, text, name string) []byte {
+	t.Helper()
+	data, err := encodeText(text, name)
+	require.NoError(t, err)
+	return data
+}
+
+func TestDetectEncoding(t *testing.T) {
+	sample := "<p>日本語のテキストです。カタカナと漢字を含みます。</p>\n"
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{name: "ascii", data: []byte("plain text"), expected: encodingUTF8},
+		{name: "utf-8", data: []byte(sample), expected: encodingUTF8},
+		{name: "utf-8 with bom", data: append([]byte("\ufeff"), sample...), expected: encodingUTF8},
+		{name: "shift_jis", data: mustEncode(t, sample, encodingShiftJIS), expected: encodingShiftJIS},
+		{name: "euc-jp", data: mustEncode(t, sample, encodingEUCJP), expected: encodingEUCJP},
+		{name: "short euc-jp", data: mustEncode(t, "あ", encodingEUCJP), expected: encodingEUCJP},
+		{name: "halfwidth kana in shift_jis", data: mustEncode(t, "ｶﾀｶﾅ、漢字", encodingShiftJIS), expected: encodingShiftJIS},
+		{
+			name:     "meta charset",
+			data:     append([]byte(`<html><head><meta http-equiv="Content-Type" content="text/html; charset=EUC-JP">`), mustEncode(t, "ｱ", encodingShiftJIS)...),
+			expected: encodingEUCJP,
+		},
+		{
+			name:     "html5 meta charset",
+			data:     append([]byte(`<meta charset="Shift_JIS">`), mustEncode(t, sample, encodingShiftJIS)...),
+			expected: encodingShiftJIS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, detectEncoding(tt.data))
+		})
+	}
+}
+
+func TestNormalizeEncoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		allowed     []string
+		expected    string
+		errContains string
+	}{
+		{name: "alias", input: "SJIS", expected: encodingShiftJIS},
+		{name: "windows-31j", input: "Windows-31J", expected: encodingShiftJIS},
+		{name: "eucjp", input: "eucJP", expected: encodingEUCJP},
+		{name: "utf8", input: "UTF8", expected: encodingUTF8},
+		{name: "special name", input: "auto", allowed: []string{encodingAuto}, expected: encodingAuto},
+		{name: "special name not allowed", input: "auto", errContains: "対応していない文字コードです: auto"},
+		{name: "unknown", input: "iso-2022-jp", errContains: "対応していない文字コードです: iso-2022-jp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeEncoding(tt.input, tt.allowed...)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestEncodeText_Unrepresentable(t *testing.T) {
+	_, err := encodeText("絵文字😀", encodingShiftJIS)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "shift_jis で表せない文字があります")
+}
+
+func TestRun_ReplaceEncoding(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "company"
+    pattern: '株式会社'
+    replacement: '(株)'`), 0644))
+	inputFile := filepath.Join(tmpDir, "page.html")
+	outputFile := filepath.Join(tmpDir, "page_replaced.html")
+	input := "<p>株式会社サンプルのページです。</p>"
+	expected := "<p>(株)サンプルのページです。</p>"
+
+	tests := []struct {
+		name           string
+		inputEncoding  string
+		args           []string
+		exitCode       int
+		outputEncoding string
+	}{
+		{name: "shift_jis written back as shift_jis", inputEncoding: encodingShiftJIS, exitCode: exitOK, outputEncoding: encodingShiftJIS},
+		{name: "euc-jp written back as euc-jp", inputEncoding: encodingEUCJP, exitCode: exitOK, outputEncoding: encodingEUCJP},
+		{name: "explicit input encoding", inputEncoding: encodingEUCJP, args: []string{"--encoding", "euc-jp"}, exitCode: exitOK, outputEncoding: encodingEUCJP},
+		{name: "convert to utf-8", inputEncoding: encodingShiftJIS, args: []string{"--output-encoding", "utf-8"}, exitCode: exitOK, outputEncoding: encodingUTF8},
+		{name: "utf-8 to shift_jis", inputEncoding: encodingUTF8, args: []string{"--output-encoding=sjis"}, exitCode: exitOK, outputEncoding: encodingShiftJIS},
+		{name: "unknown encoding", inputEncoding: encodingUTF8, args: []string{"--encoding", "latin1"}, exitCode: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(outputFile)
+			require.NoError(t, os.WriteFile(inputFile, mustEncode(t, input, tt.inputEncoding), 0644))
+			args := append([]string{"replace", "-c", configFile, inputFile}, tt.args...)
+			require.Equal(t, tt.exitCode, run(args))
+			if tt.exitCode != exitOK {
+				return
+			}
+			output, err := os.ReadFile(outputFile)
+			require.NoError(t, err)
+			require.Equal(t, mustEncode(t, expected, tt.outputEncoding), output)
+		})
+	}
+}
+
+func TestNewDocument_ShiftJIS(t *testing.T) {
+	inputFile := filepath.Join(t.TempDir(), "legacy.txt")
+	data, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("エラーが発生しました"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(inputFile, data, 0644))
+
+	input, err := readInput(inputFile)
+	require.NoError(t, err)
+	require.Empty(t, input.compression)
+	require.Empty(t, input.archive)
+	opts := &inputOptions{encoding: encodingAuto, binary: binarySkip}
+	skip, err := opts.skipBinary(input.path, input.content, false)
+	require.NoError(t, err)
+	require.False(t, skip)
+	doc, err := newDocument(input.name, input.content, opts)
+	require.NoError(t, err)
+	require.Equal(t, "エラーが発生しました", doc.text)
+	require.Equal(t, encodingShiftJIS, doc.encoding)
+
+	matches := extractMatches(doc.text, &Config{Patterns: []Pattern{{Name: "error", Pattern: `エラー`}}})
+	require.Len(t, matches, 1)
+}
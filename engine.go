@@ -0,0 +1,254 @@
+package main
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// compiledPattern は正規表現（type: regex と literal）のパターンをコンパイルした結果
+type compiledPattern struct {
+	regex *regexp.Regexp
+	err   error
+
+	// prefix はすべてのマッチの先頭にある固定文字列（空の場合は絞り込めない）
+	prefix string
+	// anchored は regex を \A で先頭に固定したもの。prefix の出現位置でだけ照合する
+	anchored *regexp.Regexp
+	// complete はパターン全体が prefix だけの固定文字列（グループなし）かどうか
+	complete bool
+}
+
+// scanEngine は複数のパターンをまとめて走査する。
+// 各パターンの固定の接頭辞を1つの Aho–Corasick オートマトンに入れ、テキストを1回走査して
+// 接頭辞の出現位置を求める。正規表現はその位置でだけ照合し、マッチし得ない範囲は読み飛ばす。
+// マッチの結果はパターンごとに FindAllStringSubmatchIndex を呼んだ場合と同じになる
+type scanEngine struct {
+	patterns  []*compiledPattern // config.Patterns と同じ順序（正規表現以外は nil）
+	prefilter *ahoCorasick
+	owners    map[string][]int // 接頭辞 → その接頭辞を持つパターンの添字
+}
+
+// edit は置換で書き換えた範囲。置換前の [oldStart, oldEnd) が置換後の [newStart, newEnd) になった
+type edit struct {
+	oldStart, oldEnd int
+	newStart, newEnd int
+}
+
+func newScanEngine(config *Config) *scanEngine {
+	e := &scanEngine{
+		patterns: make([]*compiledPattern, len(config.Patterns)),
+		owners:   make(map[string][]int),
+	}
+	var prefixes []string
+	for i, pattern := range config.Patterns {
+		if !pattern.isActive() || pattern.Type == patternTypeDictionary || pattern.Type == patternTypeWordlist || pattern.Type == patternTypeHTMLRemove {
+			continue
+		}
+		cp := compileForScan(pattern)
+		e.patterns[i] = cp
+		if cp.prefix == "" {
+			continue
+		}
+		if _, ok := e.owners[cp.prefix]; !ok {
+			prefixes = append(prefixes, cp.prefix)
+		}
+		e.owners[cp.prefix] = append(e.owners[cp.prefix], i)
+	}
+	e.prefilter = newAhoCorasick(prefixes, false)
+	return e
+}
+
+// compileForScan はパターンをコンパイルし、接頭辞で絞り込めるかどうかを調べる
+func compileForScan(pattern Pattern) *compiledPattern {
+	regex, err := compilePattern(pattern)
+	if err != nil {
+		return &compiledPattern{err: err}
+	}
+	cp := &compiledPattern{regex: regex}
+
+	prefix, complete := regex.LiteralPrefix()
+	if prefix == "" {
+		return cp
+	}
+	// LiteralPrefix は先頭の ^ や \b を無視するため、固定文字列で始まるパターンだけを対象にする
+	tree, err := syntax.Parse(regex.String(), syntax.Perl)
+	if err != nil || !startsWithLiteral(tree.Simplify()) {
+		return cp
+	}
+	// \Q...\E のように末尾に付け足すと意味が変わるパターンは絞り込みの対象にしない
+	anchored, err := regexp.Compile(`\A(?:` + regex.String() + `)`)
+	if err != nil || anchored.NumSubexp() != regex.NumSubexp() {
+		return cp
+	}
+	cp.prefix = prefix
+	cp.anchored = anchored
+	cp.complete = complete && regex.NumSubexp() == 0
+	return cp
+}
+
+// startsWithLiteral は正規表現の構文木が（大文字小文字を区別する）文字で始まるかどうかを返す
+func startsWithLiteral(re *syntax.Regexp) bool {
+	for {
+		switch re.Op {
+		case syntax.OpConcat, syntax.OpCapture:
+			if len(re.Sub) == 0 {
+				return false
+			}
+			re = re.Sub[0]
+		case syntax.OpLiteral:
+			return re.Flags&syntax.FoldCase == 0
+		default:
+			return false
+		}
+	}
+}
+
+// scan はテキストを1回走査して、パターンごとの接頭辞の出現位置（昇順）を返す
+func (e *scanEngine) scan(text string) [][]int {
+	candidates := make([][]int, len(e.patterns))
+	if len(e.owners) == 0 {
+		return candidates
+	}
+	e.prefilter.each(text, func(start, end int) {
+		for _, i := range e.owners[text[start:end]] {
+			candidates[i] = append(candidates[i], start)
+		}
+	})
+	return candidates
+}
+
+// findAll は i 番目のパターンのマッチを FindAllStringSubmatchIndex と同じ形式で返す。
+// candidates は scan で求めたそのパターンの接頭辞の出現位置。limit が正の場合は limit 件で打ち切る
+func (e *scanEngine) findAll(i int, text string, candidates []int, limit int) [][]int {
+	cp := e.patterns[i]
+	if cp.prefix == "" {
+		if limit <= 0 {
+			limit = -1
+		}
+		return cp.regex.FindAllStringSubmatchIndex(text, limit)
+	}
+
+	var locs [][]int
+	pos := 0
+	for _, start := range candidates {
+		if limit > 0 && len(locs) >= limit {
+			break
+		}
+		if start < pos {
+			continue
+		}
+		if cp.complete {
+			end := start + len(cp.prefix)
+			locs = append(locs, []int{start, end})
+			pos = end
+			continue
+		}
+		loc := cp.anchored.FindStringSubmatchIndex(text[start:])
+		if loc == nil {
+			continue
+		}
+		for j := range loc {
+			if loc[j] >= 0 {
+				loc[j] += start
+			}
+		}
+		locs = append(locs, loc)
+		pos = loc[1]
+	}
+	return locs
+}
+
+// find は i 番目のパターンのマッチを返す。scope、target、per_line があれば patternSegments の範囲だけを照合する
+func (e *scanEngine) find(i int, pattern Pattern, text string, candidates []int, limit int) ([][]int, error) {
+	if !pattern.segmented() {
+		return e.findAll(i, text, candidates, limit), nil
+	}
+	return findRegexInSegments(pattern, text, e.patterns[i].regex, limit)
+}
+
+// remap は置換後のテキストに合わせて i 番目のパターンの接頭辞の出現位置を更新する。
+// 書き換えた範囲に重ならない出現位置はずらすだけにし、書き換えた範囲の周辺だけを探し直す
+func (e *scanEngine) remap(i int, candidates []int, edits []edit, text string) []int {
+	prefix := e.patterns[i].prefix
+	n := len(prefix)
+
+	result := make([]int, 0, len(candidates))
+	j, delta := 0, 0
+	for _, pos := range candidates {
+		for j < len(edits) && edits[j].oldEnd <= pos {
+			delta += (edits[j].newEnd - edits[j].newStart) - (edits[j].oldEnd - edits[j].oldStart)
+			j++
+		}
+		if j < len(edits) && edits[j].oldStart < pos+n {
+			// 書き換えた範囲にかかっている
+			continue
+		}
+		result = append(result, pos+delta)
+	}
+
+	for _, ed := range edits {
+		from := ed.newStart - n + 1
+		if from < 0 {
+			from = 0
+		}
+		to := ed.newEnd + n - 1
+		if to > len(text) {
+			to = len(text)
+		}
+		for k := from; k < to; {
+			idx := strings.Index(text[k:to], prefix)
+			if idx < 0 {
+				break
+			}
+			result = append(result, k+idx)
+			k += idx + 1
+		}
+	}
+
+	sort.Ints(result)
+	unique := result[:0]
+	for k, pos := range result {
+		if k == 0 || pos != result[k-1] {
+			unique = append(unique, pos)
+		}
+	}
+	return unique
+}
+
+// replaceMatches は locs の各マッチをパターンの置換文字列（replace_template があればその評価結果）で
+// 置き換え、書き換えた範囲を返す。ReplaceAllString と同じく置換文字列の $1 や ${name} を展開する。
+// target が text か attribute の場合は置換結果を escapeReplacement でエスケープする
+func replaceMatches(regex *regexp.Regexp, text string, locs [][]int, pattern Pattern, counters templateCounters) (string, []edit, error) {
+	var tmpl *template.Template
+	if pattern.ReplaceTemplate != "" {
+		var err error
+		tmpl, err = compileReplaceTemplate(pattern, counters)
+		if err != nil {
+			return text, nil, err
+		}
+	}
+
+	var b, expanded strings.Builder
+	edits := make([]edit, 0, len(locs))
+	prev := 0
+	for n, loc := range locs {
+		b.WriteString(text[prev:loc[0]])
+		start := b.Len()
+		expanded.Reset()
+		if tmpl != nil {
+			if err := tmpl.Execute(&expanded, newTemplateMatch(regex, text, loc, n+1)); err != nil {
+				return text, nil, err
+			}
+		} else {
+			expanded.Write(regex.ExpandString(nil, pattern.Replacement, text, loc))
+		}
+		b.WriteString(pattern.escapeReplacement(expanded.String()))
+		edits = append(edits, edit{oldStart: loc[0], oldEnd: loc[1], newStart: start, newEnd: b.Len()})
+		prev = loc[1]
+	}
+	b.WriteString(text[prev:])
+	return b.String(), edits, nil
+}
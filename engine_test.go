@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// perPatternExtract はパターンごとにテキスト全体を走査する、エンジン導入前の抽出処理（比較用）
+func perPatternExtract(text string, config *Config) []Match {
+	var allMatches []Match
+	for _, pattern := range config.Patterns {
+		regex, err := compilePattern(pattern)
+		if err != nil {
+			continue
+		}
+		for _, loc := range regex.FindAllStringIndex(text, -1) {
+			match := text[loc[0]:loc[1]]
+			allMatches = append(allMatches, Match{
+				PatternName: pattern.Name,
+				Line:        strings.Count(text[:loc[0]], "\n") + 1,
+				Text:        match,
+				Matches:     []string{match},
+			})
+		}
+	}
+	return allMatches
+}
+
+// perPatternReplace はパターンごとに置換後のテキスト全体を走査する、エンジン導入前の置換処理（比較用）
+func perPatternReplace(text string, config *Config) string {
+	for _, pattern := range config.Patterns {
+		regex, err := compilePattern(pattern)
+		if err != nil {
+			continue
+		}
+		text = regex.ReplaceAllString(text, pattern.Replacement)
+	}
+	return text
+}
+
+func TestCompileForScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  Pattern
+		prefix   string
+		complete bool
+	}{
+		{name: "literal regex", pattern: Pattern{Pattern: "hello"}, prefix: "hello", complete: true},
+		{name: "prefix and rest", pattern: Pattern{Pattern: `<script[^>]*>`}, prefix: "<script"},
+		{name: "literal type", pattern: Pattern{Type: patternTypeLiteral, Pattern: "a.b(c)"}, prefix: "a.b(c)", complete: true},
+		{name: "group disables complete", pattern: Pattern{Pattern: "(abc)"}, prefix: "abc"},
+		{name: "leading class", pattern: Pattern{Pattern: `\d+円`}, prefix: ""},
+		{name: "anchor", pattern: Pattern{Pattern: `^abc`}, prefix: ""},
+		{name: "case insensitive", pattern: Pattern{Pattern: `(?i)abc`}, prefix: ""},
+		{name: "unterminated quote", pattern: Pattern{Pattern: `\Qabc`}, prefix: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := compileForScan(tt.pattern)
+			require.NoError(t, cp.err)
+			require.Equal(t, tt.prefix, cp.prefix)
+			require.Equal(t, tt.complete, cp.complete)
+		})
+	}
+}
+
+func TestScanEngine_MatchesPerPatternLoop(t *testing.T) {
+	configs := map[string]*Config{
+		"html cleanup": {Patterns: []Pattern{
+			{Name: "script", Pattern: `<script[^>]*>.*?</script>`, Replacement: ""},
+			{Name: "style", Pattern: `<style[^>]*>.*?</style>`, Replacement: ""},
+			{Name: "comment", Pattern: `<!--.*?-->`, Replacement: "<!-- -->"},
+			{Name: "attr", Pattern: `\s+style="[^"]*"`, Replacement: ""},
+			{Name: "empty p", Pattern: `<p>\s*</p>`, Replacement: ""},
+		}},
+		"chained replacements": {Patterns: []Pattern{
+			{Name: "a to bc", Pattern: "a", Replacement: "bc"},
+			{Name: "bcb to x", Pattern: "bcb", Replacement: "x"},
+			{Name: "x groups", Pattern: `x(b*)(c)?`, Replacement: "[$1|$2]"},
+			{Name: "bracket", Pattern: `\[\|`, Replacement: "<"},
+			{Name: "cc", Pattern: "cc", Replacement: ""},
+			{Name: "overlap", Pattern: "bb", Replacement: "b"},
+		}},
+		"mixed": {Patterns: []Pattern{
+			{Name: "named", Pattern: `ab(?P<rest>c+)`, Replacement: "${rest}A"},
+			{Name: "anchor", Pattern: `^c`, Replacement: "START"},
+			{Name: "empty", Pattern: `b*`, Replacement: "-"},
+			{Name: "fold", Pattern: `(?i)a`, Replacement: "ab"},
+			{Name: "literal", Type: patternTypeLiteral, Pattern: "-a", Replacement: "$$"},
+			{Name: "alternation", Pattern: `ca|cb`, Replacement: "a\nb"},
+			{Name: "multiline", Pattern: `a.b`, Replacement: "c"},
+			{Name: "broken", Pattern: `[`, Replacement: "never"},
+		}},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "c", "x", "-", "\n", "<p>", "</p>", "<script>", "</script>", "<!--", "-->", ` style="x"`, " "}
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 300; i++ {
+				var b strings.Builder
+				for j := rng.Intn(60); j > 0; j-- {
+					b.WriteString(alphabet[rng.Intn(len(alphabet))])
+				}
+				text := b.String()
+				require.Equal(t, perPatternExtract(text, config), extractMatches(text, config), "text=%q", text)
+				require.Equal(t, perPatternReplace(text, config), performReplacements(text, config), "text=%q", text)
+			}
+		})
+	}
+}
+
+func TestScanEngine_Remap(t *testing.T) {
+	config := &Config{Patterns: []Pattern{
+		{Name: "first", Pattern: "a", Replacement: "aba"},
+		{Name: "second", Pattern: "ab"},
+	}}
+	engine := newScanEngine(config)
+	before := "xaxab"
+	candidates := engine.scan(before)
+	require.Equal(t, []int{3}, candidates[1])
+
+	locs := engine.findAll(0, before, candidates[0], 0)
+	after, edits, err := replaceMatches(engine.patterns[0].regex, before, locs, config.Patterns[0], nil)
+	require.NoError(t, err)
+	require.Equal(t, "xabaxabab", after)
+	require.Equal(t, []int{1, 5, 7}, engine.remap(1, candidates[1], edits, after))
+}
+
+// manyPatternsConfig はHTMLのクリーニングを想定した多数のパターンの設定を作る
+func manyPatternsConfig(n int) *Config {
+	config := &Config{}
+	for i := 0; i < n; i++ {
+		config.Patterns = append(config.Patterns, Pattern{
+			Name:        fmt.Sprintf("tag%d", i),
+			Pattern:     fmt.Sprintf(`<tag%d( [^>]*)?>.*?</tag%d>`, i, i),
+			Replacement: fmt.Sprintf("[%d]", i),
+		})
+	}
+	return config
+}
+
+func manyPatternsText() string {
+	line := `<div class="entry"><p>本文のテキストです。<a href="https://example.com/">リンク</a></p><tag7 id="x">置換対象</tag7></div>` + "\n"
+	return strings.Repeat(line, 2000)
+}
+
+func BenchmarkExtractMatches_ManyPatterns(b *testing.B) {
+	config := manyPatternsConfig(60)
+	text := manyPatternsText()
+
+	b.Run("engine", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			extractMatches(text, config)
+		}
+	})
+	b.Run("per pattern", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			perPatternExtract(text, config)
+		}
+	})
+}
+
+func BenchmarkPerformReplacements_ManyPatterns(b *testing.B) {
+	config := manyPatternsConfig(60)
+	text := manyPatternsText()
+	// 置換の件数の表示で計測が乱れないよう、比較用の処理と同じく正規表現だけを対象にする
+	require.NotEmpty(b, regexp.MustCompile(`<tag7`).FindString(text))
+
+	b.Run("engine", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			performReplacements(text, config)
+		}
+	})
+	b.Run("per pattern", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			perPatternReplace(text, config)
+		}
+	})
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// field: を指定したパターンで扱う入力の形式（拡張子で判定する）
+const (
+	fieldFormatCSV   = "csv"
+	fieldFormatTSV   = "tsv"
+	fieldFormatJSONL = "jsonl"
+)
+
+// detectFieldFormat は name の拡張子から構造化された入力の形式を返す（該当しなければ空文字列）
+func detectFieldFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return fieldFormatCSV
+	case ".tsv":
+		return fieldFormatTSV
+	case ".jsonl", ".ndjson":
+		return fieldFormatJSONL
+	}
+	return ""
+}
+
+// fieldValue は field: で選んだ1つの値。[start, end) は text の中の元の表記（引用符を含む）の範囲
+type fieldValue struct {
+	start, end int
+	// value は引用符や JSON のエスケープを解いた値
+	value string
+	// line は値が始まる行、record はヘッダーを除いたレコードの番号（いずれも1から）
+	line, record int
+	// quoted は CSV の値が引用符で囲まれていたかどうか
+	quoted bool
+}
+
+// fieldValues は text を format として解析し、field に当たる値を先頭から順に返す。
+// CSV と TSV は1行目をヘッダーとし、field には列名か1から始まる列番号を指定する。
+// JSON Lines では field に a.b.0 の形式のパス（先頭の $. は省略可能）を指定し、文字列の値だけを返す
+func fieldValues(format, field, text string) ([]fieldValue, error) {
+	switch format {
+	case fieldFormatCSV, fieldFormatTSV:
+		return delimitedFieldValues(format, field, text)
+	case fieldFormatJSONL:
+		return jsonFieldValues(field, text)
+	}
+	return nil, msgErrorf(msgFieldUnsupportedInput)
+}
+
+// csvCell は CSV、TSV の1つのセル
+type csvCell struct {
+	start, end int
+	value      string
+	quoted     bool
+}
+
+func delimitedFieldValues(format, field, text string) ([]fieldValue, error) {
+	delimiter := byte(',')
+	if format == fieldFormatTSV {
+		delimiter = '\t'
+	}
+
+	var values []fieldValue
+	column := -1
+	pos, line, record := 0, 1, 0
+	for pos < len(text) {
+		recordStart, recordLine := pos, line
+		cells, next := scanDelimitedRecord(text, pos, delimiter, format == fieldFormatCSV)
+		line += strings.Count(text[pos:next], "\n")
+		pos = next
+		if len(cells) == 1 && cells[0].start == cells[0].end {
+			// 空行
+			continue
+		}
+
+		if column < 0 {
+			var err error
+			if column, err = findColumn(field, cells); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		record++
+		if column < len(cells) {
+			cell := cells[column]
+			values = append(values, fieldValue{
+				start:  cell.start,
+				end:    cell.end,
+				value:  cell.value,
+				line:   recordLine + strings.Count(text[recordStart:cell.start], "\n"),
+				record: record,
+				quoted: cell.quoted,
+			})
+		}
+	}
+	return values, nil
+}
+
+// scanDelimitedRecord は pos から始まる1レコードのセルと、次のレコードの先頭の位置を返す。
+// quoting が false（TSV）の場合は引用符を通常の文字として扱う
+func scanDelimitedRecord(text string, pos int, delimiter byte, quoting bool) ([]csvCell, int) {
+	var cells []csvCell
+	for {
+		cell := csvCell{start: pos}
+		if quoting && pos < len(text) && text[pos] == '"' {
+			cell.quoted = true
+			var b strings.Builder
+			pos++
+			for pos < len(text) {
+				quote := strings.IndexByte(text[pos:], '"')
+				if quote < 0 {
+					b.WriteString(text[pos:])
+					pos = len(text)
+					break
+				}
+				b.WriteString(text[pos : pos+quote])
+				pos += quote + 1
+				if pos < len(text) && text[pos] == '"' {
+					b.WriteByte('"')
+					pos++
+					continue
+				}
+				break
+			}
+			// 閉じる引用符の後から区切り文字までは値に含める
+			after := pos
+			for pos < len(text) && text[pos] != delimiter && text[pos] != '\n' && text[pos] != '\r' {
+				pos++
+			}
+			b.WriteString(text[after:pos])
+			cell.value = b.String()
+			cell.end = pos
+		} else {
+			for pos < len(text) && text[pos] != delimiter && text[pos] != '\n' {
+				pos++
+			}
+			cell.end = pos
+			if cell.end > cell.start && text[cell.end-1] == '\r' && (pos == len(text) || text[pos] == '\n') {
+				cell.end--
+			}
+			cell.value = text[cell.start:cell.end]
+		}
+		cells = append(cells, cell)
+
+		if pos < len(text) && text[pos] == '\r' {
+			pos++
+		}
+		if pos >= len(text) {
+			return cells, len(text)
+		}
+		if text[pos] == '\n' {
+			return cells, pos + 1
+		}
+		// 区切り文字
+		pos++
+	}
+}
+
+// findColumn は field（列名か1から始まる列番号）に当たる列の添字をヘッダーから求める
+func findColumn(field string, header []csvCell) (int, error) {
+	if n, err := strconv.Atoi(field); err == nil {
+		if n < 1 || n > len(header) {
+			return 0, msgErrorf(msgFieldNotFound, field)
+		}
+		return n - 1, nil
+	}
+	for i, cell := range header {
+		if strings.TrimSpace(cell.value) == field {
+			return i, nil
+		}
+	}
+	return 0, msgErrorf(msgFieldNotFound, field)
+}
+
+// jsonPath は field を JSON のパスの要素に分ける（$.items.0.url → items、0、url）
+func jsonPath(field string) []string {
+	field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+	return strings.Split(field, ".")
+}
+
+// jsonFrame は JSON を走査するときの入れ子になったオブジェクトか配列
+type jsonFrame struct {
+	array bool
+	// key はオブジェクトで読んだ最後のキー、index は配列の次の要素の添字
+	key       string
+	index     int
+	expectKey bool
+}
+
+func jsonFieldValues(field, text string) ([]fieldValue, error) {
+	path := jsonPath(field)
+	var values []fieldValue
+	pos, line, record := 0, 0, 0
+	for pos < len(text) {
+		line++
+		end := strings.IndexByte(text[pos:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += pos
+		}
+		lineStart := pos
+		pos = end + 1
+		if strings.TrimSpace(text[lineStart:end]) == "" {
+			continue
+		}
+		record++
+
+		found, err := scanJSONLine(text[lineStart:end], path)
+		if err != nil {
+			return nil, msgErrorf(msgFieldJSONError, line, err)
+		}
+		for _, fv := range found {
+			fv.start += lineStart
+			fv.end += lineStart
+			fv.line, fv.record = line, record
+			values = append(values, fv)
+		}
+	}
+	return values, nil
+}
+
+// scanJSONLine は1行の JSON を走査し、path にある文字列の値を返す
+func scanJSONLine(line string, path []string) ([]fieldValue, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	var stack []*jsonFrame
+	var values []fieldValue
+
+	// valueDone は値を1つ読み終えたときに親のオブジェクトか配列を次の要素に進める
+	valueDone := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.array {
+			top.index++
+		} else {
+			top.expectKey = true
+		}
+	}
+
+	for {
+		prev := int(dec.InputOffset())
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if top != nil && !top.array && top.expectKey {
+			if key, ok := token.(string); ok {
+				top.key = key
+				top.expectKey = false
+				continue
+			}
+		}
+
+		switch token := token.(type) {
+		case json.Delim:
+			switch token {
+			case '{':
+				stack = append(stack, &jsonFrame{expectKey: true})
+			case '[':
+				stack = append(stack, &jsonFrame{array: true})
+			default:
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+		case string:
+			if jsonPathEqual(stack, path) {
+				end := int(dec.InputOffset())
+				start := prev + strings.IndexByte(line[prev:end], '"')
+				values = append(values, fieldValue{start: start, end: end, value: token})
+			}
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+	return values, nil
+}
+
+// jsonPathEqual は stack が表す現在の値の位置が path と一致するかどうかを返す
+func jsonPathEqual(stack []*jsonFrame, path []string) bool {
+	if len(stack) != len(path) {
+		return false
+	}
+	for i, frame := range stack {
+		if frame.array {
+			if strconv.Itoa(frame.index) != path[i] {
+				return false
+			}
+		} else if frame.key != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeFieldValue は置換後の value を format の表記にする。
+// CSV は元の値が引用符で囲まれていたか、区切り文字、引用符、改行を含む場合に引用符で囲む
+func encodeFieldValue(format string, fv fieldValue, value string) (string, error) {
+	switch format {
+	case fieldFormatCSV:
+		if fv.quoted || strings.ContainsAny(value, ",\"\r\n") {
+			return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`, nil
+		}
+		return value, nil
+	case fieldFormatTSV:
+		if strings.ContainsAny(value, "\t\r\n") {
+			return "", msgErrorf(msgFieldInvalidTSV, fv.record)
+		}
+		return value, nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// valueMatcher は field: で選んだ値ごとにパターンを照合して置換する
+type valueMatcher struct {
+	pattern Pattern
+	find    func(value string) [][]int
+	replace func(value string, locs [][]int) (string, error)
+	// dict と hits は type: dictionary の場合のエントリごとの置換件数
+	dict *dictionary
+	hits map[string]int
+	// context は正規表現のパターンで scope や target の境界のマッチを照合し直すためのもの
+	context *regionContext
+}
+
+// newValueMatcher は pattern の種類に応じて値の照合と置換の方法を用意する。
+// scope、target、per_line は値ごとに適用する
+func newValueMatcher(pattern Pattern, counters templateCounters) (*valueMatcher, error) {
+	m := &valueMatcher{pattern: pattern}
+	var find func(string) [][]int
+	switch pattern.Type {
+	case patternTypeDictionary:
+		dict, err := loadDictionary(pattern)
+		if err != nil {
+			return nil, err
+		}
+		m.dict, m.hits = dict, make(map[string]int)
+		find = dict.matcher.findAll
+		m.replace = func(value string, locs [][]int) (string, error) {
+			replaced, hits := dict.replaceLocations(value, locs, pattern.escapeReplacement)
+			for key, n := range hits {
+				m.hits[key] += n
+			}
+			return replaced, nil
+		}
+
+	case patternTypeWordlist:
+		matcher, err := loadWordlist(pattern)
+		if err != nil {
+			return nil, err
+		}
+		find = matcher.findAll
+		m.replace = func(value string, locs [][]int) (string, error) {
+			return replaceLocations(value, locs, pattern, counters)
+		}
+
+	case patternTypeHTMLRemove:
+		return nil, msgErrorf(msgFieldUnsupportedType, pattern.Type)
+
+	default:
+		regex, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		find = func(value string) [][]int {
+			return regex.FindAllStringSubmatchIndex(value, -1)
+		}
+		m.context = contextFor(regex)
+		m.replace = func(value string, locs [][]int) (string, error) {
+			replaced, _, err := replaceMatches(regex, value, locs, pattern, counters)
+			return replaced, err
+		}
+	}
+
+	// scope と target の誤りは値ごとの照合の前に報告する
+	if pattern.Scope != nil {
+		if _, err := pattern.Scope.compile(); err != nil {
+			return nil, err
+		}
+	}
+	if pattern.Target != "" {
+		if _, _, err := parseTarget(pattern.Target); err != nil {
+			return nil, err
+		}
+	}
+	if pattern.Markdown != nil {
+		if err := pattern.Markdown.check(); err != nil {
+			return nil, err
+		}
+	}
+	m.find = func(value string) [][]int {
+		locs, err := findInSegmentsWith(pattern, value, find, m.context, 0)
+		if err != nil {
+			return nil
+		}
+		return locs
+	}
+	return m, nil
+}
+
+// fieldMatch は値の中のマッチ
+type fieldMatch struct {
+	fv   fieldValue
+	locs [][]int
+}
+
+// findFieldMatches は name の形式で text を解析し、pattern の field の値ごとのマッチを返す。
+// マッチの数は limit（per_line の場合は値の行ごと）と remaining までに減らす
+func (m *valueMatcher) findFieldMatches(text, name string, limit, remaining int) ([]fieldMatch, string, error) {
+	format := detectFieldFormat(name)
+	if format == "" {
+		return nil, "", msgErrorf(msgFieldUnsupportedInput)
+	}
+	values, err := fieldValues(format, m.pattern.Field, text)
+	if err != nil {
+		return nil, "", err
+	}
+
+	total := limit
+	if m.pattern.PerLine {
+		total = 0
+	}
+	total = minLimit(total, remaining)
+
+	var result []fieldMatch
+	count := 0
+	for _, fv := range values {
+		if total > 0 && count >= total {
+			break
+		}
+		locs := m.find(fv.value)
+		if m.pattern.PerLine {
+			locs = limitMatches(fv.value, locs, limit, true, 0)
+		}
+		if total > 0 && count+len(locs) > total {
+			locs = locs[:total-count]
+		}
+		if len(locs) > 0 {
+			result = append(result, fieldMatch{fv: fv, locs: locs})
+			count += len(locs)
+		}
+	}
+	return result, format, nil
+}
+
+// extractFieldMatches は name から読み込んだ text の pattern の field の値からマッチを収集する
+func extractFieldMatches(pattern Pattern, text, name string, limit, remaining int) ([]Match, error) {
+	m, err := newValueMatcher(pattern, templateCounters{})
+	if err != nil {
+		return nil, err
+	}
+	return m.extractFields(text, name, limit, remaining)
+}
+
+// extractFields は text の field の値からマッチを収集する。行番号はファイル全体での行番号で、
+// CSV と TSV では値の中の改行も数える（JSON Lines の \n はエスケープなので値の行番号のままにする）
+func (m *valueMatcher) extractFields(text, name string, limit, remaining int) ([]Match, error) {
+	found, format, err := m.findFieldMatches(text, name, limit, remaining)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	for _, fm := range found {
+		for _, loc := range fm.locs {
+			match := fm.fv.value[loc[0]:loc[1]]
+			line := fm.fv.line
+			if format != fieldFormatJSONL {
+				line += strings.Count(fm.fv.value[:loc[0]], "\n")
+			}
+			matches = append(matches, Match{
+				PatternName: m.pattern.Name,
+				Line:        line,
+				Text:        match,
+				Matches:     []string{match},
+				Record:      fm.fv.record,
+				Field:       m.pattern.Field,
+			})
+		}
+	}
+	return matches, nil
+}
+
+// replaceFields は text の field の値だけを置換し、置換後の text と置換数を返す。
+// 置換した値は形式に合わせて引用符やエスケープを付け直し、それ以外の部分は元のまま残す
+func (m *valueMatcher) replaceFields(text, name string, limit, remaining int) (string, int, error) {
+	found, format, err := m.findFieldMatches(text, name, limit, remaining)
+	if err != nil || len(found) == 0 {
+		return text, 0, err
+	}
+
+	var b strings.Builder
+	prev, count := 0, 0
+	for _, fm := range found {
+		replaced, err := m.replace(fm.fv.value, fm.locs)
+		if err != nil {
+			return text, 0, err
+		}
+		encoded, err := encodeFieldValue(format, fm.fv, replaced)
+		if err != nil {
+			return text, 0, err
+		}
+		b.WriteString(text[prev:fm.fv.start])
+		b.WriteString(encoded)
+		prev = fm.fv.end
+		count += len(fm.locs)
+	}
+	b.WriteString(text[prev:])
+	return b.String(), count, nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const urlsCSV = "title,url,note\r\n" +
+	"http://example.com の紹介,http://example.com/a,\r\n" +
+	"\"Quote \"\"http://x\"\"\",\"http://example.com/b,c\",\"multi\r\nline http://\"\r\n" +
+	"\r\n" +
+	"short\r\n" +
+	"last,http://example.com/d,end"
+
+const urlsJSONL = `{"title":"http://example.com","url":"http://example.com/a","tags":["http://t"]}
+{"url": "http://example.com/<b>", "meta": {"url": "http://meta"}}
+
+{"url":null,"links":[{"url":"http://one"},{"url":"http://two"}]}
+`
+
+func TestDetectFieldFormat(t *testing.T) {
+	require.Equal(t, fieldFormatCSV, detectFieldFormat("urls.CSV"))
+	require.Equal(t, fieldFormatTSV, detectFieldFormat("bundle.zip!/data/urls.tsv"))
+	require.Equal(t, fieldFormatJSONL, detectFieldFormat("log.ndjson"))
+	require.Equal(t, "", detectFieldFormat("page.html"))
+}
+
+// fieldValueResult は fieldValue の範囲を元の表記に置き換えたもの
+type fieldValueResult struct {
+	raw, value   string
+	line, record int
+	quoted       bool
+}
+
+func TestFieldValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		field    string
+		text     string
+		expected []fieldValueResult
+		wantErr  bool
+	}{
+		{
+			name:   "csv by name",
+			format: fieldFormatCSV,
+			field:  "url",
+			text:   urlsCSV,
+			expected: []fieldValueResult{
+				{raw: "http://example.com/a", value: "http://example.com/a", line: 2, record: 1},
+				{raw: `"http://example.com/b,c"`, value: "http://example.com/b,c", line: 3, record: 2, quoted: true},
+				{raw: "http://example.com/d", value: "http://example.com/d", line: 7, record: 4},
+			},
+		},
+		{
+			name:   "csv by index",
+			format: fieldFormatCSV,
+			field:  "3",
+			text:   urlsCSV,
+			expected: []fieldValueResult{
+				{line: 2, record: 1},
+				{raw: "\"multi\r\nline http://\"", value: "multi\r\nline http://", line: 3, record: 2, quoted: true},
+				{raw: "end", value: "end", line: 7, record: 4},
+			},
+		},
+		{
+			name:   "tsv keeps quotes",
+			format: fieldFormatTSV,
+			field:  "b",
+			text:   "a\tb\nx\t\"y\"\n",
+			expected: []fieldValueResult{
+				{raw: `"y"`, value: `"y"`, line: 2, record: 1},
+			},
+		},
+		{
+			name:    "unknown column",
+			format:  fieldFormatCSV,
+			field:   "link",
+			text:    urlsCSV,
+			wantErr: true,
+		},
+		{
+			name:    "column number beyond the header",
+			format:  fieldFormatCSV,
+			field:   "5",
+			text:    "a,b\nx,y\n",
+			wantErr: true,
+		},
+		{
+			name:    "column number zero",
+			format:  fieldFormatTSV,
+			field:   "0",
+			text:    "a\tb\nx\ty\n",
+			wantErr: true,
+		},
+		{
+			name:   "jsonl nested path",
+			format: fieldFormatJSONL,
+			field:  "$.links.1.url",
+			text:   urlsJSONL,
+			expected: []fieldValueResult{
+				{raw: `"http://two"`, value: "http://two", line: 4, record: 3},
+			},
+		},
+		{
+			name:    "invalid json",
+			format:  fieldFormatJSONL,
+			field:   "url",
+			text:    "{\"url\": \"a\"}\n{\"url\": }\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := fieldValues(tt.format, tt.field, tt.text)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var got []fieldValueResult
+			for _, fv := range values {
+				got = append(got, fieldValueResult{raw: tt.text[fv.start:fv.end], value: fv.value, line: fv.line, record: fv.record, quoted: fv.quoted})
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestExtract_Field(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		text     string
+		field    string
+		expected []Match
+	}{
+		{
+			name:  "csv",
+			file:  "urls.csv",
+			text:  urlsCSV,
+			field: "url",
+			expected: []Match{
+				{PatternName: "http", Line: 2, Text: "http://", Matches: []string{"http://"}, Record: 1, Field: "url"},
+				{PatternName: "http", Line: 3, Text: "http://", Matches: []string{"http://"}, Record: 2, Field: "url"},
+				{PatternName: "http", Line: 7, Text: "http://", Matches: []string{"http://"}, Record: 4, Field: "url"},
+			},
+		},
+		{
+			name:  "line inside a multi-line value",
+			file:  "urls.csv",
+			text:  urlsCSV,
+			field: "note",
+			expected: []Match{
+				{PatternName: "http", Line: 4, Text: "http://", Matches: []string{"http://"}, Record: 2, Field: "note"},
+			},
+		},
+		{
+			name:  "jsonl",
+			file:  "urls.jsonl",
+			text:  urlsJSONL,
+			field: "url",
+			expected: []Match{
+				{PatternName: "http", Line: 1, Text: "http://", Matches: []string{"http://"}, Record: 1, Field: "url"},
+				{PatternName: "http", Line: 2, Text: "http://", Matches: []string{"http://"}, Record: 2, Field: "url"},
+			},
+		},
+		{
+			name:  "escaped newline in jsonl",
+			file:  "notes.jsonl",
+			text:  "{\"a\":\"x\\nhttp://\"}\n{\"a\":\"http://\"}\n",
+			field: "a",
+			expected: []Match{
+				{PatternName: "http", Line: 1, Text: "http://", Matches: []string{"http://"}, Record: 1, Field: "a"},
+				{PatternName: "http", Line: 2, Text: "http://", Matches: []string{"http://"}, Record: 2, Field: "a"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{{Name: "http", Pattern: `http://`, Field: tt.field}}}
+			require.Equal(t, tt.expected, extractMatchesInFile(tt.text, tt.file, config))
+		})
+	}
+}
+
+func TestReplace_Field(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		text     string
+		pattern  Pattern
+		expected string
+	}{
+		{
+			name:    "csv rewrites only the column",
+			file:    "urls.csv",
+			text:    urlsCSV,
+			pattern: Pattern{Name: "https", Pattern: `^http://`, Replacement: "https://", Field: "url"},
+			expected: "title,url,note\r\n" +
+				"http://example.com の紹介,https://example.com/a,\r\n" +
+				"\"Quote \"\"http://x\"\"\",\"https://example.com/b,c\",\"multi\r\nline http://\"\r\n" +
+				"\r\n" +
+				"short\r\n" +
+				"last,https://example.com/d,end",
+		},
+		{
+			name:     "csv quotes values that need it",
+			file:     "urls.csv",
+			text:     "a,b\n1,x\n",
+			pattern:  Pattern{Name: "quote", Pattern: `x`, Replacement: `say "x", y`, Field: "b"},
+			expected: "a,b\n1,\"say \"\"x\"\", y\"\n",
+		},
+		{
+			name:     "jsonl keeps other keys and escapes strings",
+			file:     "urls.jsonl",
+			text:     urlsJSONL,
+			pattern:  Pattern{Name: "https", Type: patternTypeLiteral, Pattern: "http://", Replacement: `"https"://`, Field: "url"},
+			expected: `{"title":"http://example.com","url":"\"https\"://example.com/a","tags":["http://t"]}` + "\n" + `{"url": "\"https\"://example.com/<b>", "meta": {"url": "http://meta"}}` + "\n\n" + `{"url":null,"links":[{"url":"http://one"},{"url":"http://two"}]}` + "\n",
+		},
+		{
+			name:     "wordlist with max_replacements",
+			file:     "urls.csv",
+			text:     urlsCSV,
+			pattern:  Pattern{Name: "example", Type: patternTypeWordlist, Words: []string{"example.com"}, Replacement: "example.org", Field: "url", MaxReplacements: 2},
+			expected: "title,url,note\r\nhttp://example.com の紹介,http://example.org/a,\r\n\"Quote \"\"http://x\"\"\",\"http://example.org/b,c\",\"multi\r\nline http://\"\r\n\r\nshort\r\nlast,http://example.com/d,end",
+		},
+		{
+			name:     "tsv value with a tab is not written",
+			file:     "urls.tsv",
+			text:     "a\tb\n1\tx\n",
+			pattern:  Pattern{Name: "tab", Pattern: `x`, Replacement: "x\ty", Field: "b"},
+			expected: "a\tb\n1\tx\n",
+		},
+		{
+			name:     "not a structured file",
+			file:     "page.html",
+			text:     "http://example.com",
+			pattern:  Pattern{Name: "https", Pattern: `http://`, Replacement: "https://", Field: "url"},
+			expected: "http://example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{tt.pattern}}
+			require.Equal(t, tt.expected, performReplacementsInFile(tt.text, tt.file, config))
+		})
+	}
+}
+
+func TestRun_ExtractField(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "http"
+    pattern: 'http://'
+    replacement: 'https://'
+    field: url`), 0644))
+	inputFile := filepath.Join(tmpDir, "urls.csv")
+	require.NoError(t, os.WriteFile(inputFile, []byte(urlsCSV), 0644))
+
+	require.Equal(t, exitOK, run([]string{"extract", "-c", configFile, inputFile}))
+	require.Equal(t, exitOK, run([]string{"replace", "-c", configFile, inputFile}))
+	output, err := os.ReadFile(filepath.Join(tmpDir, "urls_replaced.csv"))
+	require.NoError(t, err)
+	values, err := fieldValues(fieldFormatCSV, "url", string(output))
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/b,c", values[1].value)
+	require.Contains(t, string(output), "http://example.com の紹介")
+}
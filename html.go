@@ -0,0 +1,308 @@
+package main
+
+import (
+	"strings"
+)
+
+// パターンの照合対象（target:）の種類
+const (
+	targetText      = "text"
+	targetAttribute = "attribute"
+	targetTag       = "tag"
+)
+
+// htmlVoidElements は終了タグを持たない要素
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlRawTextElements は内容をタグとして解釈しない要素（内容はテキストノードとして扱わない）
+var htmlRawTextElements = map[string]bool{"script": true, "style": true}
+
+// parseTarget は target の値（text、attribute:NAME、tag:NAME）を種類と名前（小文字）に分ける
+func parseTarget(target string) (kind, name string, err error) {
+	kind, name, _ = strings.Cut(target, ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case kind == targetText && name == "" && !strings.Contains(target, ":"):
+		return kind, "", nil
+	case (kind == targetAttribute || kind == targetTag) && name != "":
+		return kind, name, nil
+	}
+	return "", "", msgErrorf(msgTargetInvalid, target)
+}
+
+// htmlToken は HTML を字句解析した1つの要素（テキスト、開始タグ、終了タグ）
+type htmlToken struct {
+	kind       int
+	start, end int
+	// name はタグの名前（小文字）
+	name        string
+	attrs       []htmlAttr
+	selfClosing bool
+}
+
+// htmlToken の種類（コメント、DOCTYPE、script と style の内容はトークンにしない）
+const (
+	htmlTextToken = iota
+	htmlStartTagToken
+	htmlEndTagToken
+)
+
+// htmlAttr は開始タグの属性。[valueStart, valueEnd) は引用符を除いた値の範囲
+type htmlAttr struct {
+	name                 string
+	valueStart, valueEnd int
+}
+
+// tokenizeHTML は text をテキスト、開始タグ、終了タグに分ける。
+// 壊れたマークアップでも失敗せず、タグとして解釈できない < はテキストとして扱う
+func tokenizeHTML(text string) []htmlToken {
+	var tokens []htmlToken
+	textStart := 0
+	flushText := func(end int) {
+		if end > textStart {
+			tokens = append(tokens, htmlToken{kind: htmlTextToken, start: textStart, end: end})
+		}
+	}
+
+	pos := 0
+	for pos < len(text) {
+		lt := strings.IndexByte(text[pos:], '<')
+		if lt < 0 {
+			break
+		}
+		lt += pos
+		rest := text[lt:]
+
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			flushText(lt)
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				pos = len(text)
+			} else {
+				pos = lt + 4 + end + 3
+			}
+			textStart = pos
+
+		case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"):
+			flushText(lt)
+			pos = tagEnd(text, lt)
+			textStart = pos
+
+		case strings.HasPrefix(rest, "</") && len(rest) > 2 && isASCIILetter(rest[2]):
+			flushText(lt)
+			name := tagName(text, lt+2)
+			pos = tagEnd(text, lt)
+			tokens = append(tokens, htmlToken{kind: htmlEndTagToken, start: lt, end: pos, name: name})
+			textStart = pos
+
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			flushText(lt)
+			token := parseStartTag(text, lt)
+			tokens = append(tokens, token)
+			pos = token.end
+			if htmlRawTextElements[token.name] && !token.selfClosing {
+				// </script> までは内容をタグとして解釈しない
+				closing := strings.Index(strings.ToLower(text[pos:]), "</"+token.name)
+				if closing < 0 {
+					pos = len(text)
+				} else {
+					pos += closing
+				}
+			}
+			textStart = pos
+
+		default:
+			pos = lt + 1
+		}
+	}
+	flushText(len(text))
+	return tokens
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// tagName は pos から始まるタグの名前を小文字で返す
+func tagName(text string, pos int) string {
+	end := pos
+	for end < len(text) && !isHTMLSpace(text[end]) && text[end] != '/' && text[end] != '>' {
+		end++
+	}
+	return strings.ToLower(text[pos:end])
+}
+
+// tagEnd は start から始まるタグの直後の位置（閉じる > がなければ text の末尾）を返す
+func tagEnd(text string, start int) int {
+	end := strings.IndexByte(text[start:], '>')
+	if end < 0 {
+		return len(text)
+	}
+	return start + end + 1
+}
+
+// parseStartTag は start から始まる開始タグの名前と属性を読み取る
+func parseStartTag(text string, start int) htmlToken {
+	token := htmlToken{kind: htmlStartTagToken, start: start, name: tagName(text, start+1)}
+	pos := start + 1 + len(token.name)
+	for pos < len(text) {
+		c := text[pos]
+		switch {
+		case c == '>':
+			token.end = pos + 1
+			return token
+		case c == '/':
+			token.selfClosing = pos+1 < len(text) && text[pos+1] == '>'
+			pos++
+			continue
+		case isHTMLSpace(c):
+			pos++
+			continue
+		}
+
+		nameStart := pos
+		for pos < len(text) && !isHTMLSpace(text[pos]) && text[pos] != '=' && text[pos] != '>' && text[pos] != '/' {
+			pos++
+		}
+		attr := htmlAttr{name: strings.ToLower(text[nameStart:pos]), valueStart: pos, valueEnd: pos}
+		next := pos
+		for next < len(text) && isHTMLSpace(text[next]) {
+			next++
+		}
+		if next < len(text) && text[next] == '=' {
+			pos = next + 1
+			for pos < len(text) && isHTMLSpace(text[pos]) {
+				pos++
+			}
+			if pos < len(text) && (text[pos] == '"' || text[pos] == '\'') {
+				quote := text[pos]
+				end := strings.IndexByte(text[pos+1:], quote)
+				if end < 0 {
+					end = len(text) - pos - 1
+				}
+				attr.valueStart, attr.valueEnd = pos+1, pos+1+end
+				pos = attr.valueEnd + 1
+			} else {
+				attr.valueStart = pos
+				for pos < len(text) && !isHTMLSpace(text[pos]) && text[pos] != '>' {
+					pos++
+				}
+				attr.valueEnd = pos
+			}
+		}
+		token.attrs = append(token.attrs, attr)
+	}
+	token.end = len(text)
+	return token
+}
+
+// targetSegments は text のうち target（text、attribute:NAME、tag:NAME）に当たる範囲を先頭から順に返す
+func targetSegments(target, text string) ([][]int, error) {
+	kind, name, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	tokens := tokenizeHTML(text)
+
+	var segments [][]int
+	switch kind {
+	case targetText:
+		for _, token := range tokens {
+			if token.kind == htmlTextToken {
+				segments = append(segments, []int{token.start, token.end})
+			}
+		}
+
+	case targetAttribute:
+		for _, token := range tokens {
+			if token.kind != htmlStartTagToken {
+				continue
+			}
+			for _, attr := range token.attrs {
+				if attr.name == name && attr.valueEnd > attr.valueStart {
+					segments = append(segments, []int{attr.valueStart, attr.valueEnd})
+				}
+			}
+		}
+
+	case targetTag:
+		// 入れ子になった同じ名前の要素は外側の要素にまとめる
+		for i := 0; i < len(tokens); i++ {
+			token := tokens[i]
+			if token.kind != htmlStartTagToken || token.name != name {
+				continue
+			}
+			end := token.end
+			if !token.selfClosing && !htmlVoidElements[name] {
+				if j := matchingEndTag(tokens, i); j >= 0 {
+					end = tokens[j].end
+					i = j
+				}
+			}
+			segments = append(segments, []int{token.start, end})
+		}
+	}
+	return segments, nil
+}
+
+// matchingEndTag は tokens[i] の開始タグに対応する終了タグの添字（なければ -1）を返す
+func matchingEndTag(tokens []htmlToken, i int) int {
+	name := tokens[i].name
+	depth := 0
+	for j := i + 1; j < len(tokens); j++ {
+		switch {
+		case tokens[j].kind == htmlStartTagToken && tokens[j].name == name && !tokens[j].selfClosing:
+			depth++
+		case tokens[j].kind == htmlEndTagToken && tokens[j].name == name:
+			if depth == 0 {
+				return j
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// escapeReplacement は target が text または attribute のパターンの置換結果を、
+// テキストノードや属性値の外に出ないようにエスケープする（tag の場合はマークアップとしてそのまま使う）
+func (p Pattern) escapeReplacement(s string) string {
+	switch {
+	case strings.HasPrefix(p.Target, targetText):
+		return htmlTextEscaper.Replace(s)
+	case strings.HasPrefix(p.Target, targetAttribute):
+		return htmlAttrEscaper.Replace(s)
+	}
+	return s
+}
+
+// & は元のテキストの文字参照（&amp; など）を $1 などでそのまま戻せるようにエスケープしない
+var (
+	htmlTextEscaper = strings.NewReplacer("<", "&lt;", ">", "&gt;")
+	htmlAttrEscaper = strings.NewReplacer("<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&#39;")
+)
+
+// intersectSegments は2つの範囲の列（いずれも昇順で重ならない）の共通部分を返す
+func intersectSegments(a, b [][]int) [][]int {
+	var result [][]int
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		start, end := max(a[i][0], b[j][0]), min(a[i][1], b[j][1])
+		if start < end {
+			result = append(result, []int{start, end})
+		}
+		if a[i][1] < b[j][1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const htmlPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>old title</title>
+<style>p.old { color: red }</style>
+<script>var old = "<p>old</p>";</script>
+</head>
+<body>
+<!-- old comment -->
+<p class="old intro"
+   title='old
+tooltip'>old text <b>old</b></p>
+<div class="box"><div>old nested</div></div>
+<img src="old.png" alt=old>
+<a href=/old>old</a>
+</body>
+</html>
+`
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		kind   string
+		name   string
+		valid  bool
+	}{
+		{target: "text", kind: targetText, valid: true},
+		{target: "attribute:HREF", kind: targetAttribute, name: "href", valid: true},
+		{target: "tag:div", kind: targetTag, name: "div", valid: true},
+		{target: "text:p"},
+		{target: "attribute:"},
+		{target: "comment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			kind, name, err := parseTarget(tt.target)
+			if !tt.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.kind, kind)
+			require.Equal(t, tt.name, name)
+		})
+	}
+}
+
+func TestTargetSegments(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected []string
+	}{
+		{
+			target:   "attribute:title",
+			expected: []string{"old\ntooltip"},
+		},
+		{
+			target:   "attribute:alt",
+			expected: []string{"old"},
+		},
+		{
+			target:   "tag:div",
+			expected: []string{`<div class="box"><div>old nested</div></div>`},
+		},
+		{
+			target:   "tag:img",
+			expected: []string{`<img src="old.png" alt=old>`},
+		},
+		{
+			target:   "tag:b",
+			expected: []string{"<b>old</b>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			segments, err := targetSegments(tt.target, htmlPage)
+			require.NoError(t, err)
+			var got []string
+			for _, seg := range segments {
+				got = append(got, htmlPage[seg[0]:seg[1]])
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestTokenizeHTML_Text(t *testing.T) {
+	segments, err := targetSegments("text", `a < b <p>x</p><!-- c --><script>if (a<b) {}</script>y`)
+	require.NoError(t, err)
+	require.Equal(t, [][]int{{0, 6}, {9, 10}, {52, 53}}, segments)
+}
+
+func TestExtract_Target(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected []int
+	}{
+		// タイトル、本文のテキスト、<b>、入れ子の div、リンクの文字列（コメント、script、style、属性は除く）
+		{target: "text", expected: []int{4, 12, 12, 13, 15}},
+		{target: "attribute:class", expected: []int{10}},
+		{target: "attribute:href", expected: []int{15}},
+		{target: "tag:p", expected: []int{10, 11, 12, 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{{Name: "old", Pattern: `old`, Target: tt.target}}}
+			var lines []int
+			for _, match := range extractMatches(htmlPage, config) {
+				lines = append(lines, match.Line)
+			}
+			require.Equal(t, tt.expected, lines)
+		})
+	}
+}
+
+func TestReplace_Target(t *testing.T) {
+	text := `<p title="old">old &amp; <a href="/old">old</a></p>`
+
+	tests := []struct {
+		name     string
+		pattern  Pattern
+		expected string
+	}{
+		{
+			name:     "text is escaped",
+			pattern:  Pattern{Name: "old", Pattern: `old`, Replacement: "<new>", Target: "text"},
+			expected: `<p title="old">&lt;new&gt; &amp; <a href="/old">&lt;new&gt;</a></p>`,
+		},
+		{
+			name:     "entities are kept",
+			pattern:  Pattern{Name: "amp", Pattern: `old (&amp;)`, Replacement: "new $1", Target: "text"},
+			expected: `<p title="old">new &amp; <a href="/old">old</a></p>`,
+		},
+		{
+			name:     "attribute value is escaped",
+			pattern:  Pattern{Name: "title", Pattern: `old`, Replacement: `say "new"`, Target: "attribute:title"},
+			expected: `<p title="say &quot;new&quot;">old &amp; <a href="/old">old</a></p>`,
+		},
+		{
+			name:     "wordlist in attribute",
+			pattern:  Pattern{Name: "href", Type: patternTypeWordlist, Words: []string{"old"}, Replacement: "new", Target: "attribute:href"},
+			expected: `<p title="old">old &amp; <a href="/new">old</a></p>`,
+		},
+		{
+			name:     "greedy match stays in the attribute value",
+			pattern:  Pattern{Name: "href", Pattern: `https?://\S+`, Replacement: "https://new/", Target: "attribute:href"},
+			expected: `<p title="old">old &amp; <a href="/old">old</a></p>`,
+		},
+		{
+			name:     "tag is replaced as markup",
+			pattern:  Pattern{Name: "link", Pattern: `(?s)<a [^>]*>(.*)</a>`, Replacement: "<em>$1</em>", Target: "tag:a"},
+			expected: `<p title="old">old &amp; <em>old</em></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{tt.pattern}}
+			require.Equal(t, tt.expected, performReplacements(text, config))
+		})
+	}
+}
+
+func TestReplace_TargetAnchors(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		text     string
+		expected string
+	}{
+		{
+			name:     "text split by inline tags",
+			pattern:  `^\w+`,
+			text:     "hello <b>world</b> again",
+			expected: "X <b>world</b> again",
+		},
+		{
+			name:     "start of line after a tag",
+			pattern:  `(?m)^\w+`,
+			text:     "<p>hello <b>world</b>\nagain</p>",
+			expected: "<p>hello <b>world</b>\nX</p>",
+		},
+		{
+			name:     "greedy match stays in the text node",
+			pattern:  `\S+`,
+			text:     "<p>Hello</p>",
+			expected: "<p>X</p>",
+		},
+		{
+			name:     "end of text",
+			pattern:  `\w+$`,
+			text:     "<i>a</i> b",
+			expected: "<i>a</i> X",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{{Name: "anchor", Pattern: tt.pattern, Replacement: "X", Target: "text"}}}
+			require.Equal(t, tt.expected, performReplacements(tt.text, config))
+		})
+	}
+}
+
+func TestIntersectSegments(t *testing.T) {
+	require.Equal(t, [][]int{{2, 4}, {6, 7}, {8, 9}}, intersectSegments([][]int{{0, 4}, {6, 9}}, [][]int{{2, 7}, {8, 10}}))
+	require.Nil(t, intersectSegments([][]int{{0, 2}}, [][]int{{2, 4}}))
+}
+
+func TestRun_ValidateTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "bad"
+    pattern: 'old'
+    target: 'attr:href'`), 0644))
+
+	require.Equal(t, exitError, run([]string{"validate", "-c", configFile}))
+}
+
+func TestReplace_TargetHrefURL(t *testing.T) {
+	config := &Config{Patterns: []Pattern{{Name: "url", Pattern: `https?://\S+`, Replacement: "https://new/x", Target: "attribute:href"}}}
+	require.Equal(t, `<a href="https://new/x">link http://old/y</a>`,
+		performReplacements(`<a href="http://old/x">link http://old/y</a>`, config))
+}
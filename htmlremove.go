@@ -0,0 +1,288 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// htmlElement は開始タグから終了タグまでの要素。[start, openEnd) が開始タグ、[closeStart, end) が終了タグ
+// （終了タグがない場合は closeStart と end は openEnd と同じ）
+type htmlElement struct {
+	name       string
+	attrs      map[string]string
+	start      int
+	openEnd    int
+	closeStart int
+	end        int
+	parent     *htmlElement
+}
+
+// htmlOptionalEndTags は終了タグを省略でき、同じ名前の開始タグで暗黙に閉じる要素
+var htmlOptionalEndTags = map[string]bool{
+	"p": true, "li": true, "dt": true, "dd": true, "option": true, "tr": true, "td": true, "th": true,
+}
+
+// parseHTMLElements は text の要素を出現順に返す。<p> や <li> は同じ名前の開始タグの手前で閉じ、
+// それ以外の終了タグが省略された要素は開始タグだけの要素とする
+func parseHTMLElements(text string) []*htmlElement {
+	var elements, stack []*htmlElement
+	for _, token := range tokenizeHTML(text) {
+		switch token.kind {
+		case htmlStartTagToken:
+			if top := len(stack) - 1; top >= 0 && stack[top].name == token.name && htmlOptionalEndTags[token.name] {
+				stack[top].closeStart, stack[top].end = token.start, token.start
+				stack = stack[:top]
+			}
+			el := &htmlElement{name: token.name, attrs: make(map[string]string), start: token.start,
+				openEnd: token.end, closeStart: token.end, end: token.end}
+			for _, attr := range token.attrs {
+				if _, ok := el.attrs[attr.name]; !ok {
+					el.attrs[attr.name] = text[attr.valueStart:attr.valueEnd]
+				}
+			}
+			if len(stack) > 0 {
+				el.parent = stack[len(stack)-1]
+			}
+			elements = append(elements, el)
+			if !token.selfClosing && !htmlVoidElements[token.name] {
+				stack = append(stack, el)
+			}
+
+		case htmlEndTagToken:
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].name != token.name {
+					continue
+				}
+				stack[i].closeStart, stack[i].end = token.start, token.end
+				// 間にある閉じられていない要素は開始タグだけの要素のままにする
+				stack = stack[:i]
+				break
+			}
+		}
+	}
+	return elements
+}
+
+// compoundSelector はタグ名、#id、.class、[attr]、[attr=value] を組み合わせた1つの要素の条件
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	name  string
+	value string
+	// hasValue は [attr=value] の形式かどうか（[attr] は属性があるかだけを調べる）
+	hasValue bool
+}
+
+// htmlSelector は空白で区切った子孫セレクタ（div.ad p）。最後の要素が削除の対象になる
+type htmlSelector []compoundSelector
+
+// parseSelector は selector を解析する
+func parseSelector(selector string) (htmlSelector, error) {
+	var result htmlSelector
+	pos := 0
+	for {
+		for pos < len(selector) && isHTMLSpace(selector[pos]) {
+			pos++
+		}
+		if pos == len(selector) {
+			break
+		}
+		compound, next, ok := parseCompoundSelector(selector, pos)
+		if !ok {
+			return nil, msgErrorf(msgSelectorInvalid, selector)
+		}
+		result = append(result, compound)
+		pos = next
+	}
+	if len(result) == 0 {
+		return nil, msgErrorf(msgSelectorInvalid, selector)
+	}
+	return result, nil
+}
+
+// parseCompoundSelector は pos から空白までの1つの条件を解析し、次の位置を返す
+func parseCompoundSelector(selector string, pos int) (compoundSelector, int, bool) {
+	var c compoundSelector
+	start := pos
+	ident := func() string {
+		begin := pos
+		for pos < len(selector) && isSelectorNameChar(selector[pos]) {
+			pos++
+		}
+		return selector[begin:pos]
+	}
+
+	if pos < len(selector) && selector[pos] == '*' {
+		pos++
+	} else {
+		c.tag = strings.ToLower(ident())
+	}
+	for pos < len(selector) && !isHTMLSpace(selector[pos]) {
+		switch selector[pos] {
+		case '#':
+			pos++
+			if c.id = ident(); c.id == "" {
+				return c, pos, false
+			}
+		case '.':
+			pos++
+			class := ident()
+			if class == "" {
+				return c, pos, false
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			end := strings.IndexByte(selector[pos:], ']')
+			if end < 0 {
+				return c, pos, false
+			}
+			name, value, hasValue := strings.Cut(selector[pos+1:pos+end], "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				return c, pos, false
+			}
+			value = strings.TrimSpace(value)
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			c.attrs = append(c.attrs, attrSelector{name: name, value: value, hasValue: hasValue})
+			pos += end + 1
+		default:
+			return c, pos, false
+		}
+	}
+	return c, pos, pos > start
+}
+
+func isSelectorNameChar(c byte) bool {
+	return isASCIILetter(c) || '0' <= c && c <= '9' || c == '-' || c == '_' || c >= 0x80
+}
+
+// matches は要素が条件を満たすかどうかを返す。class は空白で区切った値のいずれかと一致すればよい
+func (c compoundSelector) matches(el *htmlElement) bool {
+	if c.tag != "" && c.tag != el.name {
+		return false
+	}
+	if c.id != "" && el.attrs["id"] != c.id {
+		return false
+	}
+	for _, class := range c.classes {
+		found := false
+		for _, value := range strings.Fields(el.attrs["class"]) {
+			if value == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, attr := range c.attrs {
+		value, ok := el.attrs[attr.name]
+		if !ok || (attr.hasValue && value != attr.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches は要素が子孫セレクタ全体を満たすかどうかを返す
+func (s htmlSelector) matches(el *htmlElement) bool {
+	if !s[len(s)-1].matches(el) {
+		return false
+	}
+	i := len(s) - 2
+	for ancestor := el.parent; ancestor != nil && i >= 0; ancestor = ancestor.parent {
+		if s[i].matches(ancestor) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+// findHTMLElements は text のうち pattern の selector に一致する要素を返す。
+// 要素を削除する場合は一致した要素の中にある要素を含めない。scope や target があれば、その範囲に収まる要素だけを返す
+func findHTMLElements(pattern Pattern, text string) ([]*htmlElement, error) {
+	selector, err := parseSelector(pattern.Selector)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := patternSegments(pattern, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*htmlElement
+	covered := 0
+	for _, el := range parseHTMLElements(text) {
+		if (!pattern.Unwrap && el.start < covered) || !selector.matches(el) || !withinSegments(segments, el.start, el.end) {
+			continue
+		}
+		found = append(found, el)
+		covered = max(covered, el.end)
+	}
+	return found, nil
+}
+
+// withinSegments は [start, end) が segments のいずれかに収まるかどうかを返す（segments が nil なら常に true）
+func withinSegments(segments [][]int, start, end int) bool {
+	if segments == nil {
+		return true
+	}
+	i := sort.Search(len(segments), func(i int) bool { return segments[i][1] >= end })
+	return i < len(segments) && segments[i][0] <= start
+}
+
+// elementLocations は要素の範囲を FindAllStringIndex と同じ形式で返す
+func elementLocations(elements []*htmlElement) [][]int {
+	locs := make([][]int, len(elements))
+	for i, el := range elements {
+		locs[i] = []int{el.start, el.end}
+	}
+	return locs
+}
+
+// limitElements は limitMatches と同じく elements をパターンと --max-count の上限までに減らす
+func limitElements(text string, elements []*htmlElement, limit int, perLine bool, remaining int) []*htmlElement {
+	byStart := make(map[int]*htmlElement, len(elements))
+	for _, el := range elements {
+		byStart[el.start] = el
+	}
+	locs := limitMatches(text, elementLocations(elements), limit, perLine, remaining)
+	kept := make([]*htmlElement, len(locs))
+	for i, loc := range locs {
+		kept[i] = byStart[loc[0]]
+	}
+	return kept
+}
+
+// removeElements は elements を text から取り除く。unwrap の場合は開始タグと終了タグだけを取り除き、内容を残す
+func removeElements(text string, elements []*htmlElement, unwrap bool) string {
+	var ranges [][]int
+	for _, el := range elements {
+		if unwrap {
+			ranges = append(ranges, []int{el.start, el.openEnd}, []int{el.closeStart, el.end})
+		} else {
+			ranges = append(ranges, []int{el.start, el.end})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	var b strings.Builder
+	prev := 0
+	for _, r := range ranges {
+		if r[0] < prev {
+			continue
+		}
+		b.WriteString(text[prev:r[0]])
+		prev = r[1]
+	}
+	b.WriteString(text[prev:])
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const adPage = `<body>
+<div class="content">
+  <p>text</p>
+  <div class="ad banner" data-slot="top"><div>ad <div>nested</div></div></div>
+  <p>more <span id="note">note</span></p>
+</div>
+<aside class="ad">side</aside>
+<div class="ad">
+  bottom
+</div>
+</body>`
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		expected htmlSelector
+		valid    bool
+	}{
+		{selector: "div", expected: htmlSelector{{tag: "div"}}, valid: true},
+		{selector: "DIV.ad.banner", expected: htmlSelector{{tag: "div", classes: []string{"ad", "banner"}}}, valid: true},
+		{selector: "#note", expected: htmlSelector{{id: "note"}}, valid: true},
+		{
+			selector: `*[data-slot="top"] p`,
+			expected: htmlSelector{{attrs: []attrSelector{{name: "data-slot", value: "top", hasValue: true}}}, {tag: "p"}},
+			valid:    true,
+		},
+		{selector: "[hidden]", expected: htmlSelector{{attrs: []attrSelector{{name: "hidden"}}}}, valid: true},
+		{selector: ""},
+		{selector: "div > p"},
+		{selector: "div."},
+		{selector: "[data-slot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := parseSelector(tt.selector)
+			if !tt.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, selector)
+		})
+	}
+}
+
+func TestFindHTMLElements(t *testing.T) {
+	tests := []struct {
+		selector string
+		unwrap   bool
+		expected []string
+	}{
+		{
+			selector: ".ad",
+			expected: []string{
+				`<div class="ad banner" data-slot="top"><div>ad <div>nested</div></div></div>`,
+				`<aside class="ad">side</aside>`,
+				"<div class=\"ad\">\n  bottom\n</div>",
+			},
+		},
+		{
+			selector: "div.content div",
+			expected: []string{`<div class="ad banner" data-slot="top"><div>ad <div>nested</div></div></div>`},
+		},
+		{
+			selector: "div.content div",
+			unwrap:   true,
+			expected: []string{
+				`<div class="ad banner" data-slot="top"><div>ad <div>nested</div></div></div>`,
+				`<div>ad <div>nested</div></div>`,
+				`<div>nested</div>`,
+			},
+		},
+		{
+			selector: "p #note",
+			expected: []string{`<span id="note">note</span>`},
+		},
+		{
+			selector: `[data-slot=top]`,
+			expected: []string{`<div class="ad banner" data-slot="top"><div>ad <div>nested</div></div></div>`},
+		},
+		{
+			selector: "aside p",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			elements, err := findHTMLElements(Pattern{Type: patternTypeHTMLRemove, Selector: tt.selector, Unwrap: tt.unwrap}, adPage)
+			require.NoError(t, err)
+			var got []string
+			for _, el := range elements {
+				got = append(got, adPage[el.start:el.end])
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestReplace_HTMLRemove(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  Pattern
+		expected string
+	}{
+		{
+			name:    "remove",
+			pattern: Pattern{Name: "ads", Type: patternTypeHTMLRemove, Selector: "div.ad"},
+			expected: `<body>
+<div class="content">
+  <p>text</p>
+  
+  <p>more <span id="note">note</span></p>
+</div>
+<aside class="ad">side</aside>
+
+</body>`,
+		},
+		{
+			name:    "unwrap",
+			pattern: Pattern{Name: "spans", Type: patternTypeHTMLRemove, Selector: "span", Unwrap: true},
+			expected: `<body>
+<div class="content">
+  <p>text</p>
+  <div class="ad banner" data-slot="top"><div>ad <div>nested</div></div></div>
+  <p>more note</p>
+</div>
+<aside class="ad">side</aside>
+<div class="ad">
+  bottom
+</div>
+</body>`,
+		},
+		{
+			name:    "max_replacements",
+			pattern: Pattern{Name: "ads", Type: patternTypeHTMLRemove, Selector: ".ad", MaxReplacements: 1},
+			expected: `<body>
+<div class="content">
+  <p>text</p>
+  
+  <p>more <span id="note">note</span></p>
+</div>
+<aside class="ad">side</aside>
+<div class="ad">
+  bottom
+</div>
+</body>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{tt.pattern}}
+			require.Equal(t, tt.expected, performReplacements(adPage, config))
+		})
+	}
+}
+
+func TestExtract_HTMLRemove(t *testing.T) {
+	config := &Config{Patterns: []Pattern{
+		{Name: "ads", Type: patternTypeHTMLRemove, Selector: ".ad"},
+		{Name: "after", Pattern: `bottom`, When: &Condition{Matched: "ads"}},
+	}}
+	var got []string
+	for _, match := range extractMatches(adPage, config) {
+		got = append(got, match.PatternName)
+		require.NotZero(t, match.Line)
+	}
+	require.Equal(t, []string{"ads", "ads", "ads", "after"}, got)
+}
+
+func TestParseHTMLElements_Unclosed(t *testing.T) {
+	text := `<div><p>one<p>two</div>`
+	elements := parseHTMLElements(text)
+	require.Len(t, elements, 3)
+	require.Equal(t, text, text[elements[0].start:elements[0].end])
+	// 終了タグのない <p> は次の <p> の手前で閉じる
+	require.Equal(t, "<p>one", text[elements[1].start:elements[1].end])
+	require.Same(t, elements[0], elements[2].parent)
+
+	// それ以外の閉じられていない要素は開始タグだけの要素になる
+	elements = parseHTMLElements(`<div><span>one</div>`)
+	require.Equal(t, 11, elements[1].end)
+	require.Equal(t, 20, elements[0].end)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// includeResolver は設定ファイルの include を再帰的に展開する
+type includeResolver struct {
+	stack  []string        // 展開中のファイル（循環の検出に使う）
+	loaded map[string]bool // 展開済みのファイル（同じファイルを二重に取り込まない）
+}
+
+func newIncludeResolver() *includeResolver {
+	return &includeResolver{loaded: make(map[string]bool)}
+}
+
+// load は設定ファイルを読み込み、include したファイルのパターンを先頭に並べた設定を返す。
+// ローカルのパターンが use で参照したパターンは、その位置のまま description、replacement、
+// replace_template、enabled、tags を上書きする
+func (r *includeResolver) load(filename string) (*Config, error) {
+	abs := filename
+	preset, isPreset := strings.CutPrefix(filename, presetPrefix)
+	if !isPreset {
+		var err error
+		abs, err = filepath.Abs(filename)
+		if err != nil {
+			return nil, msgErrorf(msgConfigReadFailed, err)
+		}
+	}
+	for i, path := range r.stack {
+		if path == abs {
+			chain := append(append([]string{}, r.stack[i:]...), abs)
+			return nil, msgErrorf(msgIncludeCycle, strings.Join(chain, " -> "))
+		}
+	}
+	if r.loaded[abs] {
+		// 別の経路で取り込み済み（循環ではない）
+		return &Config{}, nil
+	}
+	r.loaded[abs] = true
+	r.stack = append(r.stack, abs)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	var config *Config
+	var err error
+	if isPreset {
+		config, err = parsePreset(preset)
+	} else {
+		config, err = parseConfigFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []Pattern
+	owners := make(map[string]int)
+	definitions := make(map[string]string)
+
+	for _, include := range config.Include {
+		paths, err := expandInclude(filename, include)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			included, err := r.load(path)
+			if err != nil {
+				return nil, err
+			}
+			for name, body := range included.Definitions {
+				definitions[name] = body
+			}
+			for _, pattern := range included.Patterns {
+				if pattern.Name != "" {
+					if i, ok := owners[pattern.Name]; ok {
+						return nil, msgErrorf(msgPatternNameConflict, pattern.Name, patterns[i].Source, pattern.Source)
+					}
+					owners[pattern.Name] = len(patterns)
+				}
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+
+	for _, pattern := range config.Patterns {
+		if pattern.Use != "" {
+			i, ok := owners[pattern.Use]
+			if !ok {
+				return nil, msgErrorf(msgUnknownPatternRef, pattern.Use, filename)
+			}
+			if pattern.Name != "" || pattern.Pattern != "" {
+				return nil, msgErrorf(msgInvalidPatternRef, pattern.Use, filename)
+			}
+			if pattern.Description != "" {
+				patterns[i].Description = pattern.Description
+			}
+			if pattern.replacementSet {
+				patterns[i].Replacement = pattern.Replacement
+			}
+			if pattern.ReplaceTemplate != "" {
+				patterns[i].ReplaceTemplate = pattern.ReplaceTemplate
+			}
+			if pattern.Enabled != nil {
+				patterns[i].Enabled = pattern.Enabled
+			}
+			if pattern.Tags != nil {
+				patterns[i].Tags = pattern.Tags
+			}
+			continue
+		}
+
+		if pattern.Name != "" {
+			if i, ok := owners[pattern.Name]; ok {
+				return nil, msgErrorf(msgPatternNameConflict, pattern.Name, patterns[i].Source, filename)
+			}
+		}
+		if pattern.Source == "" {
+			pattern.Source = filename
+		}
+		if !isPreset {
+			pattern.Dictionary = resolveRelative(filename, pattern.Dictionary)
+			pattern.WordsFile = resolveRelative(filename, pattern.WordsFile)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	// ローカルの定義はインクルードした定義より優先する
+	for name, body := range config.Definitions {
+		definitions[name] = body
+	}
+	if len(definitions) > 0 {
+		config.Definitions = definitions
+	}
+
+	config.Include = nil
+	config.Patterns = patterns
+	return config, nil
+}
+
+// expandInclude は include の値を、取り込む側のファイルのディレクトリを基準としたパスに展開する。
+// グロブを含む場合はマッチしたファイルを名前順に返す。preset: で始まる値はそのまま返す
+func expandInclude(from, include string) ([]string, error) {
+	if strings.HasPrefix(include, presetPrefix) {
+		return []string{include}, nil
+	}
+
+	path := include
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(from), path)
+	}
+
+	if !strings.ContainsAny(path, "*?[") {
+		return []string{path}, nil
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, msgErrorf(msgIncludeGlobError, include, err)
+	}
+	return matches, nil
+}
+
+// resolveRelative は設定ファイル中の相対パスを、その設定ファイルのディレクトリを基準としたパスにする
+func resolveRelative(from, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(from), path)
+}
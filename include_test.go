@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_Include(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFile(t, filepath.Join(tmpDir, "lib", "urls.yaml"), `patterns:
+  - name: "url"
+    pattern: 'https?://\S+'
+    description: "URL"
+    replacement: '[URL]'`)
+	writeFile(t, filepath.Join(tmpDir, "lib", "logs.yaml"), `include:
+  - urls.yaml
+patterns:
+  - name: "timestamp"
+    pattern: '\d{4}-\d{2}-\d{2}'
+    replacement: '[DATE]'`)
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configFile, `include:
+  - lib/*.yaml
+patterns:
+  - use: "url"
+    replacement: ''
+  - use: "timestamp"
+    description: "日付"
+  - name: "local"
+    pattern: 'local'
+    replacement: 'LOCAL'`)
+
+	config, err := loadConfig(configFile)
+	require.NoError(t, err)
+	require.Len(t, config.Patterns, 3)
+
+	// lib/logs.yaml が先に展開され、その中で urls.yaml を取り込む。
+	// glob で再び urls.yaml にマッチしても二重には取り込まない
+	require.Equal(t, "url", config.Patterns[0].Name)
+	require.Equal(t, "", config.Patterns[0].Replacement)
+	require.Equal(t, "URL", config.Patterns[0].Description)
+	require.Equal(t, filepath.Join(tmpDir, "lib", "urls.yaml"), config.Patterns[0].Source)
+
+	require.Equal(t, "timestamp", config.Patterns[1].Name)
+	require.Equal(t, "日付", config.Patterns[1].Description)
+	require.Equal(t, "[DATE]", config.Patterns[1].Replacement)
+
+	require.Equal(t, "local", config.Patterns[2].Name)
+	require.Equal(t, configFile, config.Patterns[2].Source)
+
+	result := performReplacements("2024-01-15 https://example.com local", config)
+	require.Equal(t, "[DATE]  LOCAL", result)
+}
+
+func TestLoadConfig_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		errContains string
+	}{
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\npatterns: []",
+				"a.yaml":      "include: [b.yaml]\npatterns: []",
+				"b.yaml":      "include: [a.yaml]\npatterns: []",
+			},
+			errContains: "include が循環しています",
+		},
+		{
+			name: "name collision between included files",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml, b.yaml]\npatterns: []",
+				"a.yaml":      "patterns:\n  - name: dup\n    pattern: a",
+				"b.yaml":      "patterns:\n  - name: dup\n    pattern: b",
+			},
+			errContains: "パターン名 'dup' が重複しています",
+		},
+		{
+			name: "local pattern collides with included pattern",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\npatterns:\n  - name: dup\n    pattern: local",
+				"a.yaml":      "patterns:\n  - name: dup\n    pattern: a",
+			},
+			errContains: "パターン名 'dup' が重複しています",
+		},
+		{
+			name: "unknown reference",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\npatterns:\n  - use: missing",
+				"a.yaml":      "patterns: []",
+			},
+			errContains: "参照先のパターン 'missing'",
+		},
+		{
+			name: "reference overriding the regex",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\npatterns:\n  - use: p\n    pattern: other",
+				"a.yaml":      "patterns:\n  - name: p\n    pattern: a",
+			},
+			errContains: "tags 以外は指定できません",
+		},
+		{
+			name: "missing include file",
+			files: map[string]string{
+				"config.yaml": "include: [missing.yaml]\npatterns: []",
+			},
+			errContains: "設定ファイルの読み込みに失敗",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(tmpDir, name), content)
+			}
+
+			_, err := loadConfig(filepath.Join(tmpDir, "config.yaml"))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.errContains)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "strings"
+
+// matchLimit はパターンのマッチ数の上限（0 は上限なし）を返す。
+// max_matches は抽出と置換の両方、max_replacements は置換だけに適用し、両方あれば小さい方を使う
+func (p Pattern) matchLimit(replace bool) int {
+	limit := p.MaxMatches
+	if replace && p.MaxReplacements > 0 && (limit == 0 || p.MaxReplacements < limit) {
+		limit = p.MaxReplacements
+	}
+	return limit
+}
+
+// limitMatches は locs を先頭から limit 件（per_line の場合は行ごとに limit 件）までに減らし、
+// さらに全体を remaining 件までに減らす。limit と remaining の 0 は上限なしを表す
+func limitMatches(text string, locs [][]int, limit int, perLine bool, remaining int) [][]int {
+	if limit > 0 && perLine {
+		var kept [][]int
+		prev, count := 0, 0
+		for _, loc := range locs {
+			// 前のマッチとの間に改行があれば新しい行
+			if strings.Contains(text[prev:loc[0]], "\n") {
+				count = 0
+			}
+			prev = loc[0]
+			if count < limit {
+				kept = append(kept, loc)
+				count++
+			}
+		}
+		locs = kept
+	} else if limit > 0 && len(locs) > limit {
+		locs = locs[:limit]
+	}
+	if remaining > 0 && len(locs) > remaining {
+		locs = locs[:remaining]
+	}
+	return locs
+}
+
+// checkLimits は max_matches と max_replacements に負の値が指定されていないか確かめる
+func checkLimits(pattern Pattern) error {
+	if pattern.MaxMatches < 0 || pattern.MaxReplacements < 0 {
+		return msgErrorf(msgNegativeLimit)
+	}
+	return nil
+}
+
+// minLimit は2つの上限のうち厳しい方を返す（0 は上限なし）
+func minLimit(a, b int) int {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
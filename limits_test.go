@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPattern_MatchLimit(t *testing.T) {
+	tests := []struct {
+		name            string
+		pattern         Pattern
+		extractExpected int
+		replaceExpected int
+	}{
+		{name: "no limit", pattern: Pattern{}, extractExpected: 0, replaceExpected: 0},
+		{name: "max_matches", pattern: Pattern{MaxMatches: 3}, extractExpected: 3, replaceExpected: 3},
+		{name: "max_replacements", pattern: Pattern{MaxReplacements: 2}, extractExpected: 0, replaceExpected: 2},
+		{name: "smaller wins", pattern: Pattern{MaxMatches: 2, MaxReplacements: 5}, extractExpected: 2, replaceExpected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.extractExpected, tt.pattern.matchLimit(false))
+			require.Equal(t, tt.replaceExpected, tt.pattern.matchLimit(true))
+		})
+	}
+}
+
+func TestLimitMatches(t *testing.T) {
+	text := "a a a\na a\na"
+	locs := [][]int{{0, 1}, {2, 3}, {4, 5}, {6, 7}, {8, 9}, {10, 11}}
+
+	require.Equal(t, locs, limitMatches(text, locs, 0, false, 0))
+	require.Equal(t, locs[:2], limitMatches(text, locs, 2, false, 0))
+	require.Equal(t, [][]int{{0, 1}, {6, 7}, {10, 11}}, limitMatches(text, locs, 1, true, 0))
+	require.Equal(t, [][]int{{0, 1}, {2, 3}, {6, 7}, {8, 9}, {10, 11}}, limitMatches(text, locs, 2, true, 0))
+	require.Equal(t, [][]int{{0, 1}, {6, 7}}, limitMatches(text, locs, 1, true, 2))
+	require.Equal(t, locs[:3], limitMatches(text, locs, 0, false, 3))
+}
+
+func TestPerformReplacements_Limits(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []Pattern
+		maxCount int
+		text     string
+		expected string
+	}{
+		{
+			name:     "first canonical url only",
+			patterns: []Pattern{{Name: "canonical", Pattern: `<link rel="canonical" href="[^"]*">`, Replacement: "", MaxReplacements: 1}},
+			text:     `<link rel="canonical" href="a"><link rel="canonical" href="b">`,
+			expected: `<link rel="canonical" href="b">`,
+		},
+		{
+			name:     "max_matches also limits replacements",
+			patterns: []Pattern{{Name: "x", Type: patternTypeLiteral, Pattern: "x", Replacement: "y", MaxMatches: 2}},
+			text:     "xxxx",
+			expected: "yyxx",
+		},
+		{
+			name:     "per_line",
+			patterns: []Pattern{{Name: "first-tab", Pattern: `\t`, Replacement: ",", PerLine: true, MaxReplacements: 1}},
+			text:     "a\tb\tc\nd\te\tf\n",
+			expected: "a,b\tc\nd,e\tf\n",
+		},
+		{
+			name:     "per_line anchors",
+			patterns: []Pattern{{Name: "indent", Pattern: `^ +`, Replacement: "", PerLine: true}},
+			text:     "  a\n  b",
+			expected: "a\nb",
+		},
+		{
+			name:     "wordlist",
+			patterns: []Pattern{{Name: "ng", Type: patternTypeWordlist, Words: []string{"foo", "bar"}, Replacement: "***", MaxReplacements: 2}},
+			text:     "foo bar foo",
+			expected: "*** *** foo",
+		},
+		{
+			name: "max-count across patterns",
+			patterns: []Pattern{
+				{Name: "a", Pattern: `a`, Replacement: "A"},
+				{Name: "b", Pattern: `b`, Replacement: "B"},
+			},
+			maxCount: 3,
+			text:     "aabb",
+			expected: "AABb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: tt.patterns, MaxCount: tt.maxCount}
+			require.Equal(t, tt.expected, performReplacements(tt.text, config))
+		})
+	}
+}
+
+func TestExtractMatches_Limits(t *testing.T) {
+	text := "ERROR 1\nERROR 2 ERROR 3\nWARN 4\n"
+	config := &Config{Patterns: []Pattern{
+		{Name: "error", Pattern: `ERROR \d`, MaxMatches: 1, PerLine: true},
+		{Name: "warn", Pattern: `WARN \d`},
+	}}
+
+	matches := extractMatches(text, config)
+	require.Len(t, matches, 3)
+	require.Equal(t, "ERROR 1", matches[0].Text)
+	require.Equal(t, 2, matches[1].Line)
+	require.Equal(t, "ERROR 2", matches[1].Text)
+	require.Equal(t, "WARN 4", matches[2].Text)
+
+	config.MaxCount = 2
+	matches = extractMatches(text, config)
+	require.Len(t, matches, 2)
+	require.Equal(t, "error", matches[1].PatternName)
+}
+
+func TestRun_MaxCount(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("a a a"), 0644))
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "a"
+    pattern: 'a'
+    replacement: 'b'`), 0644))
+
+	require.Equal(t, exitOK, run([]string{"replace", "-c", configFile, "--max-count", "2", inputFile}))
+	output, err := os.ReadFile(filepath.Join(tmpDir, "input_replaced.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "b b a", string(output))
+
+	require.Equal(t, exitUsage, run([]string{"extract", "-c", configFile, "--max-count=-1", inputFile}))
+
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "a"
+    pattern: 'a'
+    max_matches: -1`), 0644))
+	require.Equal(t, exitError, run([]string{"validate", "-c", configFile}))
+}
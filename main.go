@@ -2,10 +2,10 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
@@ -16,10 +16,118 @@ type Pattern struct {
 	Pattern     string `yaml:"pattern"`
 	Description string `yaml:"description"`
 	Replacement string `yaml:"replacement"`
+
+	// Type はパターンの種類（regex、literal、wordlist、dictionary、html-remove）。省略時は regex
+	Type string `yaml:"type,omitempty"`
+
+	// Dictionary は type: dictionary で読み込む置換表（CSV、TSV、YAML）のパス。
+	// 相対パスは設定ファイルのディレクトリを基準とする
+	Dictionary string `yaml:"dictionary,omitempty"`
+
+	// Words と WordsFile は type: wordlist で探す文字列の一覧とそのファイル（1行に1語）
+	Words     []string `yaml:"words,omitempty"`
+	WordsFile string   `yaml:"words_file,omitempty"`
+
+	// Selector は type: html-remove で取り除く要素のセレクタ（tag、#id、.class、[attr=value] と子孫結合子）。
+	// Unwrap を指定すると要素の開始タグと終了タグだけを取り除き、内容を残す
+	Selector string `yaml:"selector,omitempty"`
+	Unwrap   bool   `yaml:"unwrap,omitempty"`
+
+	// WholeWord は前後が単語の文字（英数字、_、かな漢字など）でない箇所だけにマッチさせる
+	// （type: dictionary と type: wordlist）
+	WholeWord bool `yaml:"whole_word,omitempty"`
+
+	// ReplaceTemplate はマッチごとに評価する text/template 形式の置換式。
+	// 指定した場合は Replacement より優先する
+	ReplaceTemplate string `yaml:"replace_template,omitempty"`
+
+	// Enabled に false を指定したパターンは抽出・置換の対象にしない（省略時は有効）
+	Enabled *bool `yaml:"enabled,omitempty"`
+
+	// Tags は --tags でパターンを選ぶためのタグ
+	Tags []string `yaml:"tags,omitempty"`
+
+	// When はパターンを実行する条件（省略時は常に実行）
+	When *Condition `yaml:"when,omitempty"`
+
+	// Scope はパターンを照合する領域（省略時はファイル全体）
+	Scope *Scope `yaml:"scope,omitempty"`
+
+	// Target は HTML のうち照合する対象（text、attribute:NAME、tag:NAME。省略時はマークアップ全体）
+	Target string `yaml:"target,omitempty"`
+
+	// Markdown は Markdown のうち照合する区分（prose、code_block、inline_code、front_matter、link_url）
+	Markdown *MarkdownSegments `yaml:"markdown,omitempty"`
+
+	// Field は CSV、TSV の列（列名か1から始まる列番号）や JSON Lines のパス（a.b）。
+	// 指定した場合はその値だけを照合する
+	Field string `yaml:"field,omitempty"`
+
+	// MaxMatches はファイルごとのマッチ数の上限、MaxReplacements は置換数の上限（0 は上限なし）。
+	// PerLine を指定すると行ごとに照合し、上限も行ごとに数える
+	MaxMatches      int  `yaml:"max_matches,omitempty"`
+	MaxReplacements int  `yaml:"max_replacements,omitempty"`
+	PerLine         bool `yaml:"per_line,omitempty"`
+
+	// Use はインクルードしたファイルのパターンを名前で参照し、
+	// description と replacement をローカルで上書きする場合に指定する
+	Use string `yaml:"use,omitempty"`
+
+	// Template は {{名前}} を展開する前のパターン（展開した場合のみ設定される）
+	Template string `yaml:"-"`
+
+	// Stage はパターンが属するステージの名前（stages: で定義した場合のみ）
+	Stage string `yaml:"-"`
+
+	// Source はパターンを定義した設定ファイルのパス（config showで表示）
+	Source string `yaml:"-"`
+
+	// replacementSet は YAML で replacement キーが指定されていたかどうか（空文字列での上書きと区別する）
+	replacementSet bool
+}
+
+// UnmarshalYAML は replacement キーの有無を記録しながらパターンを読み込む
+func (p *Pattern) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Pattern
+	if err := unmarshal((*plain)(p)); err != nil {
+		return err
+	}
+
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	_, p.replacementSet = keys["replacement"]
+	return nil
+}
+
+// isEmpty は pattern が空の（処理対象外の）エントリかどうかを返す。
+// pattern を使わない wordlist、dictionary、html-remove は pattern が空でも対象とする
+func (p Pattern) isEmpty() bool {
+	switch p.Type {
+	case "", patternTypeRegex, patternTypeLiteral:
+		return p.Pattern == ""
+	}
+	return false
+}
+
+// isActive は抽出・置換で処理するパターンかどうか（空のエントリと enabled: false は除く）を返す
+func (p Pattern) isActive() bool {
+	return !p.isEmpty() && (p.Enabled == nil || *p.Enabled)
 }
 
 type Config struct {
-	Patterns []Pattern `yaml:"patterns"`
+	// Description は設定ファイル全体の説明（プリセット一覧で表示）
+	Description string   `yaml:"description,omitempty"`
+	Include     []string `yaml:"include,omitempty"`
+	// Definitions はパターン中で {{名前}} として参照できる部分正規表現
+	Definitions map[string]string `yaml:"definitions,omitempty"`
+	Patterns    []Pattern         `yaml:"patterns"`
+	// Stages は順番に実行するパターンのまとまり。読み込み時に patterns の後ろに展開する
+	Stages []Stage `yaml:"stages,omitempty"`
+
+	// MaxCount はファイルごとの抽出・置換するマッチの合計の上限（--max-count。0 は上限なし）
+	MaxCount int `yaml:"-"`
 }
 
 type Match struct {
@@ -27,146 +135,340 @@ type Match struct {
 	Line        int
 	Text        string
 	Matches     []string
+
+	// File はアーカイブのエントリのマッチの場合に bundle.zip!/path/page.html の形式の名前を持つ
+	File string
+
+	// Record と Field は field: を指定したパターンのマッチの場合にレコードの番号とフィールドを持つ
+	Record int
+	Field  string
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("使用方法: go run main.go <入力ファイルパス> [設定ファイルパス] [オプション]")
-		fmt.Println("例: go run main.go /home/yamadatt/git/ameblo_url_list/interi20250915.txt")
-		fmt.Println("    go run main.go /home/yamadatt/git/ameblo_url_list/interi20250915.txt config.yaml")
-		fmt.Println("    go run main.go /home/yamadatt/git/ameblo_url_list/interi20250915.txt config.yaml --replace")
-		fmt.Println("")
-		fmt.Println("オプション:")
-		fmt.Println("  --replace, -r  : 抽出ではなく置換を実行し、結果を出力")
-		os.Exit(1)
-	}
-
-	inputFile := os.Args[1]
-	configFile := "config.yaml"
-	replaceMode := false
+	os.Exit(run(os.Args[1:]))
+}
 
-	// 引数を解析
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		if arg == "--replace" || arg == "-r" {
-			replaceMode = true
-		} else if !strings.HasPrefix(arg, "-") {
-			configFile = arg
+// compilePattern はパターンを複数行対応（(?s)フラグ付き）でコンパイルする。
+// type: literal の場合は文字列をそのまま探す正規表現にする
+func compilePattern(pattern Pattern) (*regexp.Regexp, error) {
+	switch pattern.Type {
+	case "", patternTypeRegex:
+	case patternTypeLiteral:
+		if pattern.Pattern == "" {
+			return nil, msgErrorf(msgEmptyLiteral)
 		}
+		return regexp.Compile(regexp.QuoteMeta(pattern.Pattern))
+	default:
+		return nil, msgErrorf(msgUnknownPatternType, pattern.Type)
 	}
+	return regexp.Compile("(?s)" + pattern.Pattern)
+}
 
-	config, err := loadConfig(configFile)
-	if err != nil {
-		log.Fatalf("設定ファイルの読み込みエラー: %v", err)
-	}
-
-	content, err := os.ReadFile(inputFile)
-	if err != nil {
-		log.Fatalf("ファイルの読み込みエラー: %v", err)
-	}
-
-	text := string(content)
-
-	if replaceMode {
-		// 置換モード
-		replacedText := performReplacements(text, config)
-
-		// 出力ファイル名を生成（元ファイル名_replaced.拡張子）
-		outputFile := generateOutputFileName(inputFile)
+// extractMatches は各パターンにマッチした文字列を行番号付きで収集する
+func extractMatches(text string, config *Config) []Match {
+	return extractMatchesInFile(text, "", config)
+}
 
-		// ファイルに保存
-		err = os.WriteFile(outputFile, []byte(replacedText), 0644)
-		if err != nil {
-			log.Fatalf("ファイル保存エラー: %v", err)
+// extractMatchesInFile は inputFile から読み込んだ text からマッチを収集する。
+// when の条件を満たさないパターンは使わない。max_matches と --max-count の上限に達したら照合をやめる
+func extractMatchesInFile(text, inputFile string, config *Config) []Match {
+	var allMatches []Match
+	engine := newScanEngine(config)
+	candidates := engine.scan(text)
+	state := newConditionState(inputFile, text)
+	remaining := config.MaxCount
+
+	for i, pattern := range config.Patterns {
+		if !pattern.isActive() || !state.allows(pattern) {
+			continue
 		}
+		limit := pattern.matchLimit(false)
+		stopAt := minLimit(limit, remaining)
 
-		fmt.Fprintf(os.Stderr, "置換結果を保存しました: %s\n", outputFile)
-	} else {
-		// 抽出モード（従来の動作）
-		var allMatches []Match
+		if pattern.Field != "" {
+			matches, err := extractFieldMatches(pattern, text, inputFile, limit, remaining)
+			if err != nil {
+				fmt.Print(msgf(msgFieldError, pattern.Name, err))
+				continue
+			}
+			allMatches = append(allMatches, matches...)
+			state.matched[pattern.Name] = len(matches) > 0
+			if config.MaxCount > 0 {
+				if remaining -= len(matches); remaining <= 0 {
+					break
+				}
+			}
+			continue
+		}
 
-		for _, pattern := range config.Patterns {
-			if pattern.Pattern == "" {
+		var locs [][]int
+		var err error
+		switch pattern.Type {
+		case patternTypeDictionary:
+			dict, loadErr := loadDictionary(pattern)
+			if loadErr != nil {
+				fmt.Print(msgf(msgDictionaryError, pattern.Name, loadErr))
 				continue
 			}
+			locs, err = findInSegments(pattern, text, dict.matcher.findAll, stopAt)
 
-			regex, err := regexp.Compile("(?s)" + pattern.Pattern)
-			if err != nil {
-				fmt.Printf("正規表現エラー ('%s'): %v\n", pattern.Name, err)
+		case patternTypeWordlist:
+			matcher, loadErr := loadWordlist(pattern)
+			if loadErr != nil {
+				fmt.Print(msgf(msgWordlistError, pattern.Name, loadErr))
 				continue
 			}
+			locs, err = findInSegments(pattern, text, matcher.findAll, stopAt)
 
-			matches := regex.FindAllString(text, -1)
-			if len(matches) > 0 {
-				// マッチした位置を特定して行番号を計算
-				for _, match := range matches {
-					lineNumber := 1
-					index := strings.Index(text, match)
-					if index >= 0 {
-						lineNumber = strings.Count(text[:index], "\n") + 1
-					}
+		case patternTypeHTMLRemove:
+			elements, findErr := findHTMLElements(pattern, text)
+			if findErr != nil {
+				fmt.Print(msgf(msgSelectorError, pattern.Name, findErr))
+				continue
+			}
+			locs = elementLocations(elements)
 
-					allMatches = append(allMatches, Match{
-						PatternName: pattern.Name,
-						Line:        lineNumber,
-						Text:        match,
-						Matches:     []string{match},
-					})
-				}
+		default:
+			if err := engine.patterns[i].err; err != nil {
+				fmt.Print(msgf(msgRegexError, pattern.Name, err))
+				continue
 			}
+			locs, err = engine.find(i, pattern, text, candidates[i], stopAt)
+		}
+		if err != nil {
+			fmt.Print(msgf(msgScopeError, pattern.Name, err))
+			continue
+		}
+		locs = limitMatches(text, locs, limit, pattern.PerLine, remaining)
+
+		// マッチした位置から行番号を計算（scope や target がある場合もファイル全体での行番号）
+		for _, loc := range locs {
+			match := text[loc[0]:loc[1]]
+			allMatches = append(allMatches, Match{
+				PatternName: pattern.Name,
+				Line:        strings.Count(text[:loc[0]], "\n") + 1,
+				Text:        match,
+				Matches:     []string{match},
+			})
 		}
 
-		printResults(allMatches, config)
+		state.matched[pattern.Name] = len(locs) > 0
+		if config.MaxCount > 0 {
+			if remaining -= len(locs); remaining <= 0 {
+				break
+			}
+		}
 	}
+
+	return allMatches
 }
 
+// loadConfig は設定ファイルを読み込み、include と definitions の参照を展開する
 func loadConfig(filename string) (*Config, error) {
+	config, err := newIncludeResolver().load(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := expandDefinitions(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parseConfigFile は1つの設定ファイルを読み込む（include は展開しない）
+func parseConfigFile(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("設定ファイルの読み込みに失敗: %w", err)
+		return nil, msgErrorf(msgConfigReadFailed, err)
 	}
 
+	return parseConfigData(data)
+}
+
+// parseConfigData は設定のYAMLを解析する
+func parseConfigData(data []byte) (*Config, error) {
 	var config Config
-	err = yaml.Unmarshal(data, &config)
+	err := yaml.Unmarshal(data, &config)
 	if err != nil {
-		return nil, fmt.Errorf("YAML解析エラー: %w", err)
+		return nil, msgErrorf(msgYAMLParseError, err)
 	}
+	flattenStages(&config)
 
 	return &config, nil
 }
 
 func performReplacements(text string, config *Config) string {
+	return performReplacementsInFile(text, "", config)
+}
+
+// performReplacementsInFile は inputFile から読み込んだ text を置換する。
+// inputFile はパターンの when（拡張子の条件）の評価に使う。
+// 置換数が max_matches、max_replacements、--max-count の上限に達したらそれ以上置換しない
+func performReplacementsInFile(text, inputFile string, config *Config) string {
 	if config == nil {
 		return text
 	}
 
 	result := text
 	totalReplacements := 0
-
-	for _, pattern := range config.Patterns {
-		if pattern.Pattern == "" {
+	counters := make(templateCounters)
+	engine := newScanEngine(config)
+	candidates := engine.scan(result)
+	rescan := false
+	state := newConditionState(inputFile, text)
+	var stages stageStats
+	remaining := config.MaxCount
+
+	for i, pattern := range config.Patterns {
+		if !pattern.isActive() {
 			continue
 		}
-
-		regex, err := regexp.Compile("(?s)" + pattern.Pattern)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "正規表現エラー ('%s'): %v\n", pattern.Name, err)
+		if !state.allows(pattern) {
+			fmt.Fprint(os.Stderr, msgf(msgConditionSkipped, pattern.Name))
 			continue
 		}
 
-		// 置換前のマッチ数をカウント
-		matches := regex.FindAllString(result, -1)
-		matchCount := len(matches)
+		limit := pattern.matchLimit(true)
+		stopAt := minLimit(limit, remaining)
 
-		if matchCount > 0 {
-			// 置換実行
-			result = regex.ReplaceAllString(result, pattern.Replacement)
-			totalReplacements += matchCount
-			fmt.Fprintf(os.Stderr, "[%s] %d件置換しました\n", pattern.Name, matchCount)
+		matchCount := 0
+		switch {
+		case pattern.Field != "":
+			m, err := newValueMatcher(pattern, counters)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgFieldError, pattern.Name, err))
+				continue
+			}
+			replaced, n, err := m.replaceFields(result, inputFile, limit, remaining)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgFieldError, pattern.Name, err))
+				continue
+			}
+			if n > 0 {
+				result = replaced
+				rescan = true
+				matchCount = n
+				fmt.Fprint(os.Stderr, msgf(msgReplacedCount, pattern.Name, matchCount))
+				if m.dict != nil {
+					for _, hit := range m.dict.sortedHits(m.hits) {
+						fmt.Fprint(os.Stderr, msgf(msgDictionaryHit, hit.Key, hit.Value, hit.Count))
+					}
+				}
+			}
+
+		case pattern.Type == patternTypeDictionary:
+			dict, err := loadDictionary(pattern)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgDictionaryError, pattern.Name, err))
+				continue
+			}
+			locs, err := findInSegments(pattern, result, dict.matcher.findAll, stopAt)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgScopeError, pattern.Name, err))
+				continue
+			}
+			locs = limitMatches(result, locs, limit, pattern.PerLine, remaining)
+			replaced, hits := dict.replaceLocations(result, locs, pattern.escapeReplacement)
+			if len(hits) > 0 {
+				result = replaced
+				rescan = true
+				for _, n := range hits {
+					matchCount += n
+				}
+				fmt.Fprint(os.Stderr, msgf(msgReplacedCount, pattern.Name, matchCount))
+				for _, hit := range dict.sortedHits(hits) {
+					fmt.Fprint(os.Stderr, msgf(msgDictionaryHit, hit.Key, hit.Value, hit.Count))
+				}
+			}
+
+		case pattern.Type == patternTypeWordlist:
+			matcher, err := loadWordlist(pattern)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgWordlistError, pattern.Name, err))
+				continue
+			}
+			locs, err := findInSegments(pattern, result, matcher.findAll, stopAt)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgScopeError, pattern.Name, err))
+				continue
+			}
+			locs = limitMatches(result, locs, limit, pattern.PerLine, remaining)
+			if len(locs) > 0 {
+				replaced, err := replaceLocations(result, locs, pattern, counters)
+				if err != nil {
+					fmt.Fprint(os.Stderr, msgf(msgTemplateError, pattern.Name, err))
+					continue
+				}
+				result = replaced
+				rescan = true
+				matchCount = len(locs)
+				fmt.Fprint(os.Stderr, msgf(msgReplacedCount, pattern.Name, matchCount))
+			}
+
+		case pattern.Type == patternTypeHTMLRemove:
+			elements, err := findHTMLElements(pattern, result)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgSelectorError, pattern.Name, err))
+				continue
+			}
+			elements = limitElements(result, elements, limit, pattern.PerLine, remaining)
+			if len(elements) > 0 {
+				result = removeElements(result, elements, pattern.Unwrap)
+				rescan = true
+				matchCount = len(elements)
+				fmt.Fprint(os.Stderr, msgf(msgReplacedCount, pattern.Name, matchCount))
+			}
+
+		default:
+			cp := engine.patterns[i]
+			if cp.err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgRegexError, pattern.Name, cp.err))
+				continue
+			}
+			if rescan {
+				// 置換表や単語リストで書き換えた後は接頭辞の出現位置を求め直す
+				candidates = engine.scan(result)
+				rescan = false
+			}
+
+			// 置換前のマッチ数をカウント
+			locs, err := engine.find(i, pattern, result, candidates[i], stopAt)
+			if err != nil {
+				fmt.Fprint(os.Stderr, msgf(msgScopeError, pattern.Name, err))
+				continue
+			}
+			locs = limitMatches(result, locs, limit, pattern.PerLine, remaining)
+			if len(locs) > 0 {
+				// 置換実行
+				replaced, edits, err := replaceMatches(cp.regex, result, locs, pattern, counters)
+				if err != nil {
+					fmt.Fprint(os.Stderr, msgf(msgTemplateError, pattern.Name, err))
+					continue
+				}
+				result = replaced
+				// 後続のパターンの接頭辞の出現位置を置換後のテキストに合わせる
+				for j := i + 1; j < len(config.Patterns); j++ {
+					if engine.patterns[j] != nil && engine.patterns[j].prefix != "" {
+						candidates[j] = engine.remap(j, candidates[j], edits, result)
+					}
+				}
+				matchCount = len(locs)
+				fmt.Fprint(os.Stderr, msgf(msgReplacedCount, pattern.Name, matchCount))
+			}
+		}
+
+		totalReplacements += matchCount
+		state.matched[pattern.Name] = matchCount > 0
+		stages.add(pattern.Stage, matchCount)
+		if config.MaxCount > 0 {
+			if remaining -= matchCount; remaining <= 0 {
+				break
+			}
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "総置換数: %d件\n", totalReplacements)
+	stages.print()
+	fmt.Fprint(os.Stderr, msgf(msgTotalReplacements, totalReplacements))
 	return result
 }
 
@@ -181,25 +483,59 @@ func generateOutputFileName(inputFile string) string {
 }
 
 func printResults(matches []Match, config *Config) {
-	fmt.Printf("\n=== 抽出結果 ===\n")
-	fmt.Printf("総マッチ数: %d\n\n", len(matches))
+	fmt.Print(msg(msgResultsHeader))
+	fmt.Print(msgf(msgTotalMatches, len(matches)))
 
 	patternStats := make(map[string]int)
+	entryStats := make(map[string]map[string]int)
 
 	for _, match := range matches {
 		patternStats[match.PatternName]++
-		fmt.Printf("[%s] 行 %d:\n", match.PatternName, match.Line)
+		if entryStats[match.PatternName] == nil {
+			entryStats[match.PatternName] = make(map[string]int)
+		}
+		entryStats[match.PatternName][match.Text]++
+		switch {
+		case match.Field != "" && match.File != "":
+			fmt.Print(msgf(msgMatchFieldInFile, match.PatternName, match.File, match.Line, match.Record, match.Field))
+		case match.Field != "":
+			fmt.Print(msgf(msgMatchField, match.PatternName, match.Line, match.Record, match.Field))
+		case match.File != "":
+			fmt.Print(msgf(msgMatchLineInFile, match.PatternName, match.File, match.Line))
+		default:
+			fmt.Print(msgf(msgMatchLine, match.PatternName, match.Line))
+		}
 		for _, m := range match.Matches {
 			fmt.Printf("  → %s\n", m)
 		}
 		fmt.Println()
 	}
 
-	fmt.Println("=== パターン別統計 ===")
+	fmt.Println(msg(msgStatsHeader))
 	for _, pattern := range config.Patterns {
-		if pattern.Pattern != "" {
+		if pattern.isActive() {
 			count := patternStats[pattern.Name]
-			fmt.Printf("%-15s: %d件 (%s)\n", pattern.Name, count, pattern.Description)
+			fmt.Print(msgf(msgStatsLine, pattern.Name, count, pattern.Description))
+			if pattern.Type == patternTypeDictionary {
+				printEntryStats(entryStats[pattern.Name])
+			}
+		}
+	}
+}
+
+// printEntryStats は辞書パターンのエントリごとのマッチ数を件数の多い順に表示する
+func printEntryStats(stats map[string]int) {
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if stats[keys[i]] != stats[keys[j]] {
+			return stats[keys[i]] > stats[keys[j]]
 		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		fmt.Print(msgf(msgEntryStatsLine, key, stats[key]))
 	}
-}
\ No newline at end of file
+}
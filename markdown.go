@@ -0,0 +1,334 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Markdown の区分（markdown: の include と exclude に指定する）
+const (
+	markdownProse       = "prose"
+	markdownCodeBlock   = "code_block"
+	markdownInlineCode  = "inline_code"
+	markdownFrontMatter = "front_matter"
+	markdownLinkURL     = "link_url"
+)
+
+var markdownKinds = map[string]bool{
+	markdownProse: true, markdownCodeBlock: true, markdownInlineCode: true, markdownFrontMatter: true, markdownLinkURL: true,
+}
+
+// MarkdownSegments は Markdown のうちパターンを照合する区分（markdown:）。
+// include に指定した区分だけ、または exclude に指定した区分以外で照合する
+type MarkdownSegments struct {
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// check は include と exclude のどちらか一方に既知の区分が指定されているか確かめる
+func (m *MarkdownSegments) check() error {
+	if (len(m.Include) == 0) == (len(m.Exclude) == 0) {
+		return msgErrorf(msgMarkdownInvalid)
+	}
+	for _, kind := range append(append([]string{}, m.Include...), m.Exclude...) {
+		if !markdownKinds[kind] {
+			return msgErrorf(msgMarkdownUnknownKind, kind)
+		}
+	}
+	return nil
+}
+
+// allows は区分 kind を照合するかどうかを返す
+func (m *MarkdownSegments) allows(kind string) bool {
+	list := m.Include
+	if len(list) == 0 {
+		list = m.Exclude
+	}
+	found := false
+	for _, k := range list {
+		if k == kind {
+			found = true
+			break
+		}
+	}
+	return found == (len(m.Include) > 0)
+}
+
+// segments は text を Markdown として区分に分け、照合する区分の範囲を返す。
+// 隣り合う照合する範囲は1つにまとめる（prose と link_url を指定すれば [文字列](URL) 全体を照合できる）
+func (m *MarkdownSegments) segments(text string) ([][]int, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	var result [][]int
+	for _, seg := range markdownSegments(text) {
+		if !m.allows(seg.kind) || seg.start == seg.end {
+			continue
+		}
+		if n := len(result); n > 0 && result[n-1][1] == seg.start {
+			result[n-1][1] = seg.end
+			continue
+		}
+		result = append(result, []int{seg.start, seg.end})
+	}
+	return result, nil
+}
+
+// markdownSegment は区分が kind の範囲 [start, end)
+type markdownSegment struct {
+	kind       string
+	start, end int
+}
+
+var (
+	markdownFence     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	markdownListItem  = regexp.MustCompile(`^ {0,3}([-+*]|[0-9]{1,9}[.)])( |\t|$)`)
+	markdownReference = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:[ \t]*(<[^>\n]*>|\S+)`)
+	markdownAutolink  = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.\-]{1,31}:[^\s<>]*|[^\s<>@]+@[^\s<>@]+)>`)
+)
+
+// markdownSegments は text 全体を先頭から区分ごとの範囲に分ける。
+// 先頭の --- で囲んだ YAML が front_matter、``` や ~~~ で囲んだブロックと空行の後の4文字の字下げが code_block で、
+// それ以外の部分をさらに inline_code、link_url、prose に分ける
+func markdownSegments(text string) []markdownSegment {
+	var blocks []markdownSegment
+	pos := 0
+	if end := frontMatterEnd(text); end > 0 {
+		blocks = append(blocks, markdownSegment{kind: markdownFrontMatter, start: 0, end: end})
+		pos = end
+	}
+
+	proseStart := pos
+	addCode := func(start, end int) {
+		if start > proseStart {
+			blocks = append(blocks, markdownSegment{kind: markdownProse, start: proseStart, end: start})
+		}
+		blocks = append(blocks, markdownSegment{kind: markdownCodeBlock, start: start, end: end})
+		proseStart = end
+	}
+
+	prevBlank, inList := true, false
+	for pos < len(text) {
+		lineEnd := nextLine(text, pos)
+		line := strings.TrimRight(text[pos:lineEnd], "\r\n")
+
+		if fence := markdownFence.FindStringSubmatch(line); fence != nil && !(fence[1][0] == '`' && strings.Contains(line[len(fence[0]):], "`")) {
+			// 同じ文字で同じ長さ以上のフェンスまで（閉じていなければ末尾まで）
+			start, end := pos, len(text)
+			for p := lineEnd; p < len(text); {
+				next := nextLine(text, p)
+				closing := strings.TrimRight(text[p:next], "\r\n")
+				if f := markdownFence.FindString(closing); f != "" && strings.TrimSpace(closing) == strings.TrimSpace(f) &&
+					f[len(f)-1] == fence[1][0] && len(strings.TrimSpace(f)) >= len(fence[1]) {
+					end = next
+					break
+				}
+				p = next
+			}
+			addCode(start, end)
+			pos, prevBlank = end, false
+			continue
+		}
+
+		if prevBlank && !inList && isIndentedCode(line) {
+			// 字下げされた行と間の空行が続く限りコードとする
+			start, end := pos, lineEnd
+			for p := lineEnd; p < len(text); {
+				next := nextLine(text, p)
+				l := strings.TrimRight(text[p:next], "\r\n")
+				if isIndentedCode(l) {
+					end = next
+				} else if strings.TrimSpace(l) != "" {
+					break
+				}
+				p = next
+			}
+			addCode(start, end)
+			pos, prevBlank = end, false
+			continue
+		}
+
+		blank := strings.TrimSpace(line) == ""
+		switch {
+		case markdownListItem.MatchString(line):
+			inList = true
+		case !blank && !isIndented(line) && prevBlank:
+			inList = false
+		}
+		prevBlank = blank
+		pos = lineEnd
+	}
+	if proseStart < len(text) {
+		blocks = append(blocks, markdownSegment{kind: markdownProse, start: proseStart, end: len(text)})
+	}
+
+	var segments []markdownSegment
+	for _, block := range blocks {
+		if block.kind == markdownProse {
+			segments = append(segments, inlineSegments(text, block.start, block.end)...)
+		} else {
+			segments = append(segments, block)
+		}
+	}
+	return segments
+}
+
+// frontMatterEnd は text の先頭が --- で始まる YAML のフロントマターであればその直後の位置を、なければ 0 を返す
+func frontMatterEnd(text string) int {
+	first := nextLine(text, 0)
+	if strings.TrimRight(text[:first], " \t\r\n") != "---" || first == len(text) {
+		return 0
+	}
+	for pos := first; pos < len(text); {
+		next := nextLine(text, pos)
+		line := strings.TrimRight(text[pos:next], " \t\r\n")
+		if line == "---" || line == "..." {
+			return next
+		}
+		pos = next
+	}
+	return 0
+}
+
+// nextLine は pos を含む行の次の行の先頭（最後の行なら text の末尾）を返す
+func nextLine(text string, pos int) int {
+	if i := strings.IndexByte(text[pos:], '\n'); i >= 0 {
+		return pos + i + 1
+	}
+	return len(text)
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+}
+
+func isIndentedCode(line string) bool {
+	return isIndented(line) && strings.TrimSpace(line) != ""
+}
+
+// inlineSegments は text の [start, end) の本文を inline_code、link_url、prose に分ける
+func inlineSegments(text string, start, end int) []markdownSegment {
+	var segments []markdownSegment
+	proseStart := start
+	add := func(kind string, s, e int) {
+		if s > proseStart {
+			segments = append(segments, markdownSegment{kind: markdownProse, start: proseStart, end: s})
+		}
+		segments = append(segments, markdownSegment{kind: kind, start: s, end: e})
+		proseStart = e
+	}
+
+	brackets := 0
+	for i := start; i < end; {
+		// 行頭の参照リンクの定義（[id]: URL）
+		if i == start || text[i-1] == '\n' {
+			if loc := markdownReference.FindStringSubmatchIndex(text[i:end]); loc != nil {
+				urlStart, urlEnd := i+loc[2], i+loc[3]
+				if text[urlStart] == '<' {
+					urlStart, urlEnd = urlStart+1, urlEnd-1
+				}
+				add(markdownLinkURL, urlStart, urlEnd)
+				i += loc[3]
+				continue
+			}
+		}
+
+		switch c := text[i]; {
+		case c == '\\' && i+1 < end:
+			i += 2
+		case c == '`':
+			n := 1
+			for i+n < end && text[i+n] == '`' {
+				n++
+			}
+			if closing := closingBackticks(text[i+n:end], n); closing >= 0 {
+				add(markdownInlineCode, i, i+n+closing+n)
+				i += n + closing + n
+			} else {
+				i += n
+			}
+		case c == '<':
+			if loc := markdownAutolink.FindStringSubmatchIndex(text[i:end]); loc != nil {
+				add(markdownLinkURL, i+loc[2], i+loc[3])
+				i += loc[1]
+			} else {
+				i++
+			}
+		case c == '[':
+			brackets++
+			i++
+		case c == ']' && brackets > 0 && i+1 < end && text[i+1] == '(':
+			brackets--
+			urlStart, urlEnd, next := linkDestination(text, i+2, end)
+			if urlEnd > urlStart {
+				add(markdownLinkURL, urlStart, urlEnd)
+			}
+			i = next
+		case c == ']' && brackets > 0:
+			brackets--
+			i++
+		default:
+			i++
+		}
+	}
+	if proseStart < end {
+		segments = append(segments, markdownSegment{kind: markdownProse, start: proseStart, end: end})
+	}
+	return segments
+}
+
+// closingBackticks は s の中でちょうど n 個続く ` の位置（なければ -1）を返す
+func closingBackticks(s string, n int) int {
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && s[j] == '`' {
+			j++
+		}
+		if j-i == n {
+			return i
+		}
+		i = j
+	}
+	return -1
+}
+
+// linkDestination は ]( の直後の pos から始まるリンク先の URL の範囲と、リンクの ) の直後の位置を返す
+func linkDestination(text string, pos, end int) (int, int, int) {
+	for pos < end && (text[pos] == ' ' || text[pos] == '\t') {
+		pos++
+	}
+	urlStart, urlEnd := pos, pos
+	if pos < end && text[pos] == '<' {
+		closing := strings.IndexByte(text[pos:end], '>')
+		if closing < 0 {
+			return pos, pos, pos
+		}
+		urlStart, urlEnd = pos+1, pos+closing
+		pos += closing + 1
+	} else {
+		depth := 0
+		for pos < end && !isHTMLSpace(text[pos]) {
+			if text[pos] == '(' {
+				depth++
+			} else if text[pos] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+			pos++
+		}
+		urlEnd = pos
+	}
+
+	// タイトル（"..."）を読み飛ばして ) まで進む
+	closing := strings.IndexByte(text[pos:end], ')')
+	if closing < 0 {
+		return urlStart, urlEnd, urlEnd
+	}
+	return urlStart, urlEnd, pos + closing + 1
+}
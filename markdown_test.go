@@ -0,0 +1,153 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const blogPost = "---\n" +
+	"title: http://old.example.com の紹介\n" +
+	"---\n" +
+	"# 見出し http://old.example.com\n" +
+	"\n" +
+	"本文の [リンク](http://old.example.com/a \"タイトル\") と `http://old.example.com` です。\n" +
+	"<http://old.example.com/auto> と ``a ` b`` も。\n" +
+	"\n" +
+	"```sh\n" +
+	"curl http://old.example.com\n" +
+	"```\n" +
+	"\n" +
+	"    wget http://old.example.com\n" +
+	"\n" +
+	"- リスト\n" +
+	"\n" +
+	"    リストの続き http://old.example.com\n" +
+	"\n" +
+	"[ref]: <http://old.example.com/ref>\n"
+
+func TestMarkdownSegments(t *testing.T) {
+	var got []string
+	for _, seg := range markdownSegments(blogPost) {
+		if seg.kind != markdownProse {
+			got = append(got, seg.kind+": "+blogPost[seg.start:seg.end])
+		}
+	}
+	require.Equal(t, []string{
+		"front_matter: ---\ntitle: http://old.example.com の紹介\n---\n",
+		"link_url: http://old.example.com/a",
+		"inline_code: `http://old.example.com`",
+		"link_url: http://old.example.com/auto",
+		"inline_code: ``a ` b``",
+		"code_block: ```sh\ncurl http://old.example.com\n```\n",
+		"code_block:     wget http://old.example.com\n",
+		"link_url: http://old.example.com/ref",
+	}, got)
+}
+
+func TestMarkdownSegments_Fences(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "tilde fence with a shorter closing",
+			text:     "~~~~\n~~~\ncode\n~~~~\nafter\n",
+			expected: []string{"~~~~\n~~~\ncode\n~~~~\n"},
+		},
+		{
+			name:     "unclosed fence runs to the end",
+			text:     "text\n```\ncode\n",
+			expected: []string{"```\ncode\n"},
+		},
+		{
+			name:     "backticks in the info string are not a fence",
+			text:     "``` a ` b\ntext\n",
+			expected: nil,
+		},
+		{
+			name:     "front matter must be closed",
+			text:     "---\ntitle: x\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, seg := range markdownSegments(tt.text) {
+				if seg.kind == markdownCodeBlock || seg.kind == markdownFrontMatter {
+					got = append(got, tt.text[seg.start:seg.end])
+				}
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestMarkdownSegments_Check(t *testing.T) {
+	require.NoError(t, (&MarkdownSegments{Include: []string{markdownProse}}).check())
+	require.Error(t, (&MarkdownSegments{}).check())
+	require.Error(t, (&MarkdownSegments{Include: []string{markdownProse}, Exclude: []string{markdownCodeBlock}}).check())
+	require.Error(t, (&MarkdownSegments{Exclude: []string{"html"}}).check())
+}
+
+func TestExtract_Markdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown *MarkdownSegments
+		expected []int
+	}{
+		{name: "prose", markdown: &MarkdownSegments{Include: []string{markdownProse}}, expected: []int{4, 17}},
+		{name: "link_url", markdown: &MarkdownSegments{Include: []string{markdownLinkURL}}, expected: []int{6, 7, 19}},
+		{name: "front_matter", markdown: &MarkdownSegments{Include: []string{markdownFrontMatter}}, expected: []int{2}},
+		{name: "exclude code", markdown: &MarkdownSegments{Exclude: []string{markdownCodeBlock, markdownInlineCode}}, expected: []int{2, 4, 6, 7, 17, 19}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{{Name: "old", Pattern: `http://old\.example\.com`, Markdown: tt.markdown}}}
+			var lines []int
+			for _, match := range extractMatches(blogPost, config) {
+				lines = append(lines, match.Line)
+			}
+			require.Equal(t, tt.expected, lines)
+		})
+	}
+}
+
+func TestReplace_Markdown(t *testing.T) {
+	text := "---\nurl: http://a\n---\nsee [http://a](http://a) and `http://a`\n\n```\nhttp://a\n```\n"
+
+	tests := []struct {
+		name     string
+		markdown *MarkdownSegments
+		expected string
+	}{
+		{
+			name:     "skip code and front matter",
+			markdown: &MarkdownSegments{Exclude: []string{markdownCodeBlock, markdownInlineCode, markdownFrontMatter}},
+			expected: "---\nurl: http://a\n---\nsee [https://a](https://a) and `http://a`\n\n```\nhttp://a\n```\n",
+		},
+		{
+			name:     "only link urls",
+			markdown: &MarkdownSegments{Include: []string{markdownLinkURL}},
+			expected: "---\nurl: http://a\n---\nsee [http://a](https://a) and `http://a`\n\n```\nhttp://a\n```\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{{Name: "https", Pattern: `http://`, Replacement: "https://", Markdown: tt.markdown}}}
+			require.Equal(t, tt.expected, performReplacements(text, config))
+		})
+	}
+}
+
+func TestReplace_MarkdownProseAroundCode(t *testing.T) {
+	config := &Config{Patterns: []Pattern{{Name: "upper", Pattern: `.+`, ReplaceTemplate: `{{upper .Match}}`,
+		Markdown: &MarkdownSegments{Include: []string{markdownProse}}}}}
+	require.Equal(t, "HELLO `code` WORLD [LINK](http://example.com)\n",
+		performReplacements("hello `code` world [link](http://example.com)\n", config))
+}
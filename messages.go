@@ -0,0 +1,488 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	langJapanese = "ja"
+	langEnglish  = "en"
+)
+
+// currentLang は出力メッセージの言語。main()で--langや環境変数から決定される
+var currentLang = langJapanese
+
+// メッセージキー
+const (
+	msgUsage                  = "usage"
+	msgCommandUsage           = "command_usage"
+	msgOptionsHeader          = "options_header"
+	msgArgInputFile           = "arg_input_file"
+	msgArgText                = "arg_text"
+	msgCmdExtract             = "cmd_extract"
+	msgCmdReplace             = "cmd_replace"
+	msgCmdValidate            = "cmd_validate"
+	msgCmdTest                = "cmd_test"
+	msgCmdVersion             = "cmd_version"
+	msgCmdHelp                = "cmd_help"
+	msgFlagConfig             = "flag_config"
+	msgFlagLang               = "flag_lang"
+	msgFlagPattern            = "flag_pattern"
+	msgFlagReplacement        = "flag_replacement"
+	msgUnknownCommand         = "unknown_command"
+	msgMissingInput           = "missing_input"
+	msgTooManyArgs            = "too_many_args"
+	msgStdinReadError         = "stdin_read_error"
+	msgValidateOK             = "validate_ok"
+	msgValidateFailed         = "validate_failed"
+	msgReplacedHeader         = "replaced_header"
+	msgCmdConfig              = "cmd_config"
+	msgArgConfigSub           = "arg_config_sub"
+	msgConfigNotFound         = "config_not_found"
+	msgConfigShowLayers       = "config_show_layers"
+	msgConfigShowSource       = "config_show_source"
+	msgIncludeCycle           = "include_cycle"
+	msgPatternNameConflict    = "pattern_name_conflict"
+	msgUnknownPatternRef      = "unknown_pattern_ref"
+	msgInvalidPatternRef      = "invalid_pattern_ref"
+	msgIncludeGlobError       = "include_glob_error"
+	msgCmdPresets             = "cmd_presets"
+	msgArgPresetsSub          = "arg_presets_sub"
+	msgFlagPreset             = "flag_preset"
+	msgUnknownPreset          = "unknown_preset"
+	msgConfigShowTemplate     = "config_show_template"
+	msgDefinitionUndefined    = "definition_undefined"
+	msgDefinitionCycle        = "definition_cycle"
+	msgDefinitionTooDeep      = "definition_too_deep"
+	msgPatternExpandError     = "pattern_expand_error"
+	msgFlagVar                = "flag_var"
+	msgInvalidVar             = "invalid_var"
+	msgMissingVariables       = "missing_variables"
+	msgMalformedPlaceholder   = "malformed_placeholder"
+	msgUnclosedPlaceholder    = "unclosed_placeholder"
+	msgEmptyPlaceholder       = "empty_placeholder"
+	msgTemplateError          = "template_error"
+	msgUnknownPatternType     = "unknown_pattern_type"
+	msgEmptyLiteral           = "empty_literal"
+	msgWordlistEmpty          = "wordlist_empty"
+	msgWordsFileReadError     = "words_file_read_error"
+	msgWordlistError          = "wordlist_error"
+	msgDictionaryMissing      = "dictionary_missing"
+	msgDictionaryReadError    = "dictionary_read_error"
+	msgDictionaryFormat       = "dictionary_format"
+	msgDictionaryColumns      = "dictionary_columns"
+	msgDictionaryEmptyKey     = "dictionary_empty_key"
+	msgDictionaryDuplicateKey = "dictionary_duplicate_key"
+	msgDictionaryError        = "dictionary_error"
+	msgDictionaryHit          = "dictionary_hit"
+	msgEntryStatsLine         = "entry_stats_line"
+	msgFlagOnly               = "flag_only"
+	msgFlagSkip               = "flag_skip"
+	msgFlagTags               = "flag_tags"
+	msgUnknownPatternName     = "unknown_pattern_name"
+	msgUnknownTag             = "unknown_tag"
+	msgConditionSkipped       = "condition_skipped"
+	msgUnknownConditionRef    = "unknown_condition_ref"
+	msgStageStatsHeader       = "stage_stats_header"
+	msgStageStatsLine         = "stage_stats_line"
+	msgConfigShowStage        = "config_show_stage"
+	msgScopeInvalid           = "scope_invalid"
+	msgScopeError             = "scope_error"
+	msgNegativeLimit          = "negative_limit"
+	msgLimitError             = "limit_error"
+	msgFlagMaxCount           = "flag_max_count"
+	msgNegativeMaxCount       = "negative_max_count"
+	msgFlagEncoding           = "flag_encoding"
+	msgFlagOutputEncoding     = "flag_output_encoding"
+	msgUnknownEncoding        = "unknown_encoding"
+	msgDetectedEncoding       = "detected_encoding"
+	msgDecodeFailed           = "decode_failed"
+	msgEncodeFailed           = "encode_failed"
+	msgFlagNormalizeNewlines  = "flag_normalize_newlines"
+	msgFlagGzip               = "flag_gzip"
+	msgDecompressFailed       = "decompress_failed"
+	msgArchiveReadError       = "archive_read_error"
+	msgArchiveWriteError      = "archive_write_error"
+	msgArchiveMember          = "archive_member"
+	msgMatchLineInFile        = "match_line_in_file"
+	msgFlagBinary             = "flag_binary"
+	msgUnknownBinaryMode      = "unknown_binary_mode"
+	msgBinarySkipped          = "binary_skipped"
+	msgBinaryNotSaved         = "binary_not_saved"
+	msgBinaryInput            = "binary_input"
+	msgTargetInvalid          = "target_invalid"
+	msgSelectorInvalid        = "selector_invalid"
+	msgSelectorError          = "selector_error"
+	msgFieldError             = "field_error"
+	msgFieldUnsupportedInput  = "field_unsupported_input"
+	msgFieldUnsupportedType   = "field_unsupported_type"
+	msgFieldNotFound          = "field_not_found"
+	msgFieldJSONError         = "field_json_error"
+	msgFieldInvalidTSV        = "field_invalid_tsv"
+	msgMatchField             = "match_field"
+	msgMatchFieldInFile       = "match_field_in_file"
+	msgMarkdownInvalid        = "markdown_invalid"
+	msgMarkdownUnknownKind    = "markdown_unknown_kind"
+	msgFlagURLs               = "flag_urls"
+	msgFlagURLDepth           = "flag_url_depth"
+	msgNegativeURLDepth       = "negative_url_depth"
+	msgURLNotAbsolute         = "url_not_absolute"
+	msgURLHostHeader          = "url_host_header"
+	msgURLHostLine            = "url_host_line"
+	msgURLPrefixLine          = "url_prefix_line"
+	msgURLInvalid             = "url_invalid"
+	msgURLTotal               = "url_total"
+	msgConfigLoadError        = "config_load_error"
+	msgFileReadError          = "file_read_error"
+	msgFileSaveError          = "file_save_error"
+	msgSavedOutput            = "saved_output"
+	msgRegexError             = "regex_error"
+	msgConfigReadFailed       = "config_read_failed"
+	msgYAMLParseError         = "yaml_parse_error"
+	msgReplacedCount          = "replaced_count"
+	msgTotalReplacements      = "total_replacements"
+	msgResultsHeader          = "results_header"
+	msgTotalMatches           = "total_matches"
+	msgMatchLine              = "match_line"
+	msgStatsHeader            = "stats_header"
+	msgStatsLine              = "stats_line"
+	msgUnknownLang            = "unknown_lang"
+)
+
+var catalog = map[string]map[string]string{
+	langJapanese: {
+		msgUsage: "使用方法: regex-extractor <コマンド> [オプション] <入力ファイルパス>\n" +
+			"\n" +
+			"コマンド:\n" +
+			"%s\n" +
+			"コマンドを省略した場合は extract として実行します。\n" +
+			"各コマンドのオプションは \"regex-extractor <コマンド> --help\" で確認できます。\n" +
+			"\n" +
+			"例: regex-extractor extract --config config.yaml /home/yamadatt/git/ameblo_url_list/interi20250915.txt\n" +
+			"    regex-extractor replace -c html_clean.yaml webpage.html\n" +
+			"    regex-extractor validate -c config.yaml",
+		msgCommandUsage:           "使用方法: regex-extractor %s [オプション] %s\n\n%s\n",
+		msgOptionsHeader:          "オプション:",
+		msgArgInputFile:           "<入力ファイルパス>",
+		msgArgText:                "[テキスト]",
+		msgCmdExtract:             "パターンにマッチした文字列を抽出して表示",
+		msgCmdReplace:             "パターンで置換し、元ファイル名_replaced.拡張子 に保存",
+		msgCmdValidate:            "設定ファイルを読み込み、すべての正規表現を検証",
+		msgCmdTest:                "引数または標準入力のテキストにパターンを適用して結果を表示",
+		msgCmdVersion:             "バージョンを表示",
+		msgCmdHelp:                "ヘルプを表示",
+		msgFlagConfig:             "設定ファイルのパス（複数指定可、後の指定ほど優先）",
+		msgFlagLang:               "出力メッセージの言語 (ja|en)。既定値はLC_ALL/LANGから判定",
+		msgFlagPattern:            "設定ファイルの代わりに使う正規表現",
+		msgFlagReplacement:        "--pattern と組み合わせる置換文字列",
+		msgUnknownCommand:         "不明なコマンドです: %s",
+		msgMissingInput:           "入力ファイルパスを指定してください",
+		msgTooManyArgs:            "引数が多すぎます: %s",
+		msgStdinReadError:         "標準入力の読み込みエラー: %w",
+		msgValidateOK:             "設定ファイルは有効です: %d件のパターン\n",
+		msgValidateFailed:         "%d件のパターンに誤りがあります",
+		msgReplacedHeader:         "=== 置換結果 ===",
+		msgCmdConfig:              "有効な設定（マージ結果と各パターンの定義元）を表示",
+		msgArgConfigSub:           "show",
+		msgConfigNotFound:         "設定ファイルが見つかりません（--config、%[3]s、%[2]s、カレントディレクトリの%[1]s のいずれかで指定してください）",
+		msgConfigShowLayers:       "# 読み込んだ設定ファイル（優先度の低い順）:",
+		msgConfigShowSource:       "定義元: %s",
+		msgIncludeCycle:           "include が循環しています: %s",
+		msgPatternNameConflict:    "パターン名 '%s' が重複しています（%s と %s）",
+		msgUnknownPatternRef:      "参照先のパターン '%s' がインクルードしたファイルにありません (%s)",
+		msgInvalidPatternRef:      "'%s' を参照するパターンには description、replacement、replace_template、enabled、tags 以外は指定できません (%s)",
+		msgIncludeGlobError:       "include のパターンが不正です (%s): %w",
+		msgCmdPresets:             "組み込みプリセットの一覧（list）や内容（show <名前>）を表示",
+		msgArgPresetsSub:          "list | show <名前>",
+		msgFlagPreset:             "組み込みプリセットを使用（複数指定可）",
+		msgUnknownPreset:          "不明なプリセットです: %s（presets list で一覧を確認できます）",
+		msgConfigShowTemplate:     "展開前: %s",
+		msgDefinitionUndefined:    "未定義の名前を参照しています: {{%s}}",
+		msgDefinitionCycle:        "definitions の参照が循環しています: %s",
+		msgDefinitionTooDeep:      "definitions の展開が深すぎます（上限 %d 段）: %s",
+		msgPatternExpandError:     "パターン '%s' の展開に失敗: %w",
+		msgFlagVar:                "置換文字列の ${var:key} に渡す値 key=value（複数指定可）",
+		msgInvalidVar:             "--var は key=value の形式で指定してください: %s",
+		msgMissingVariables:       "置換文字列で参照している変数が指定されていません: %s",
+		msgMalformedPlaceholder:   "パターン '%s' の置換文字列が不正です: %w",
+		msgUnclosedPlaceholder:    "プレースホルダーが閉じられていません: %s",
+		msgEmptyPlaceholder:       "プレースホルダーの名前が空です: %s",
+		msgTemplateError:          "置換テンプレートエラー ('%s'): %v\n",
+		msgUnknownPatternType:     "不明な type です: %s（regex、literal、wordlist、dictionary、html-remove のいずれかを指定してください）",
+		msgEmptyLiteral:           "type: literal の pattern が空です",
+		msgWordlistEmpty:          "パターン '%s' の words または words_file に文字列を指定してください",
+		msgWordsFileReadError:     "単語リストの読み込みに失敗: %w",
+		msgWordlistError:          "単語リストエラー ('%s'): %v\n",
+		msgDictionaryMissing:      "パターン '%s' の dictionary に置換表のファイルを指定してください",
+		msgDictionaryReadError:    "置換表の読み込みに失敗: %w",
+		msgDictionaryFormat:       "置換表の形式を判別できません: %s（拡張子は .csv、.tsv、.yaml のいずれか）",
+		msgDictionaryColumns:      "%s:%d: キーと値の2列が必要です",
+		msgDictionaryEmptyKey:     "%s:%d: キーが空です",
+		msgDictionaryDuplicateKey: "%s:%d: キー '%s' が重複しています",
+		msgDictionaryError:        "置換表エラー ('%s'): %v\n",
+		msgDictionaryHit:          "    %s → %s: %d件\n",
+		msgEntryStatsLine:         "    %s: %d件\n",
+		msgFlagOnly:               "指定した名前のパターンだけを使う（カンマ区切り、enabled: false のパターンも有効になる）",
+		msgFlagSkip:               "指定した名前のパターンを使わない（カンマ区切り）",
+		msgFlagTags:               "指定したタグのいずれかを持つパターンだけを使う（カンマ区切り）",
+		msgUnknownPatternName:     "--%s で指定したパターンがありません: %s",
+		msgUnknownTag:             "--tags で指定したタグを持つパターンがありません: %s",
+		msgConditionSkipped:       "[%s] when の条件を満たさないためスキップしました\n",
+		msgUnknownConditionRef:    "パターン '%s' の when.matched が、それより前にないパターン '%s' を参照しています",
+		msgStageStatsHeader:       "=== ステージ別統計 ===",
+		msgStageStatsLine:         "%-15s: %d件置換\n",
+		msgConfigShowStage:        "ステージ: %s",
+		msgScopeInvalid:           "scope には inside と outside のどちらか一方を指定してください",
+		msgScopeError:             "scope/target/markdown エラー ('%s'): %v\n",
+		msgNegativeLimit:          "max_matches と max_replacements には0以上の値を指定してください",
+		msgLimitError:             "上限の指定エラー ('%s'): %v\n",
+		msgFlagMaxCount:           "ファイルごとに抽出・置換するマッチの合計の上限（0 は上限なし）",
+		msgNegativeMaxCount:       "--max-count には0以上の値を指定してください: %d",
+		msgFlagEncoding:           "入力ファイルの文字コード（auto、utf-8、shift_jis、euc-jp）",
+		msgFlagOutputEncoding:     "置換結果の文字コード（same は入力と同じ。utf-8、shift_jis、euc-jp）",
+		msgUnknownEncoding:        "対応していない文字コードです: %s（utf-8、shift_jis、euc-jp のいずれかを指定してください）",
+		msgDetectedEncoding:       "%s の文字コードを %s と判定しました\n",
+		msgDecodeFailed:           "%s からの変換に失敗しました: %w",
+		msgEncodeFailed:           "%s で表せない文字があります（--output-encoding utf-8 を指定してください）: %w",
+		msgFlagNormalizeNewlines:  "CRLF の改行を LF にしてから照合する（置換結果は元の改行に戻す）",
+		msgFlagGzip:               "置換結果を gzip で圧縮して保存する（ファイル名に .gz を付ける）",
+		msgDecompressFailed:       "%s の展開に失敗しました: %w",
+		msgArchiveReadError:       "アーカイブの読み込みエラー (%s): %w",
+		msgArchiveWriteError:      "アーカイブの書き込みエラー (%s): %w",
+		msgArchiveMember:          "--- %s ---\n",
+		msgMatchLineInFile:        "[%s] %s:%d:\n",
+		msgFlagBinary:             "バイナリファイルの扱い（skip: スキップ、text: テキストとして抽出、error: エラー）",
+		msgUnknownBinaryMode:      "--binary には skip、text、error のいずれかを指定してください: %s",
+		msgBinarySkipped:          "バイナリファイルのためスキップしました: %s\n",
+		msgBinaryNotSaved:         "バイナリファイルの置換結果は保存しません: %s\n",
+		msgBinaryInput:            "バイナリファイルです: %s（テキストとして扱う場合は --binary=text を指定してください）",
+		msgTargetInvalid:          "target には text、attribute:属性名、tag:タグ名 のいずれかを指定してください: %s",
+		msgSelectorInvalid:        "selector を解析できません（tag、#id、.class、[attr=value] を空白で区切って指定してください）: '%s'",
+		msgSelectorError:          "セレクタエラー ('%s'): %v\n",
+		msgFieldError:             "フィールドエラー ('%s'): %v\n",
+		msgFieldUnsupportedInput:  "field は拡張子が .csv、.tsv、.jsonl、.ndjson のファイルにだけ指定できます",
+		msgFieldUnsupportedType:   "type: %s のパターンには field を指定できません",
+		msgFieldNotFound:          "ヘッダーに列がありません: %s",
+		msgFieldJSONError:         "%d行目の JSON を解析できません: %v",
+		msgFieldInvalidTSV:        "%d件目のレコードの置換結果にタブまたは改行が含まれるため TSV に書き出せません",
+		msgMatchField:             "[%s] 行 %d（レコード %d、フィールド %s）:\n",
+		msgMatchFieldInFile:       "[%s] %s:%d（レコード %d、フィールド %s）:\n",
+		msgMarkdownInvalid:        "markdown には include と exclude のどちらか一方を指定してください",
+		msgMarkdownUnknownKind:    "不明な Markdown の区分です: %s（prose、code_block、inline_code、front_matter、link_url のいずれかを指定してください）",
+		msgFlagURLs:               "マッチを URL として正規化し、重複を除いて一覧を表示する（ホスト別の件数は標準エラー出力に表示）",
+		msgFlagURLDepth:           "--urls でパスの接頭辞ごとに集計するディレクトリの深さ",
+		msgNegativeURLDepth:       "--url-depth には 0 以上の値を指定してください: %d",
+		msgURLNotAbsolute:         "スキームとホストを含む URL ではありません: %s",
+		msgURLHostHeader:          "=== ホスト別の件数 ===\n",
+		msgURLHostLine:            "%s: %d件（重複を除いて %d件）\n",
+		msgURLPrefixLine:          "  %s: %d件（重複を除いて %d件）\n",
+		msgURLInvalid:             "URL として解釈できません: %s\n",
+		msgURLTotal:               "URL: %d件（重複を除いて %d件、解釈できないもの %d件）\n",
+		msgConfigLoadError:        "設定ファイルの読み込みエラー: %w",
+		msgFileReadError:          "ファイルの読み込みエラー: %w",
+		msgFileSaveError:          "ファイル保存エラー: %w",
+		msgSavedOutput:            "置換結果を保存しました: %s\n",
+		msgRegexError:             "正規表現エラー ('%s'): %v\n",
+		msgConfigReadFailed:       "設定ファイルの読み込みに失敗: %w",
+		msgYAMLParseError:         "YAML解析エラー: %w",
+		msgReplacedCount:          "[%s] %d件置換しました\n",
+		msgTotalReplacements:      "総置換数: %d件\n",
+		msgResultsHeader:          "\n=== 抽出結果 ===\n",
+		msgTotalMatches:           "総マッチ数: %d\n\n",
+		msgMatchLine:              "[%s] 行 %d:\n",
+		msgStatsHeader:            "=== パターン別統計 ===",
+		msgStatsLine:              "%-15s: %d件 (%s)\n",
+		msgUnknownLang:            "未対応の言語です: %s（ja または en を指定してください）",
+	},
+	langEnglish: {
+		msgUsage: "Usage: regex-extractor <command> [options] <input file>\n" +
+			"\n" +
+			"Commands:\n" +
+			"%s\n" +
+			"If the command is omitted, extract is used.\n" +
+			"Run \"regex-extractor <command> --help\" for the options of each command.\n" +
+			"\n" +
+			"Example: regex-extractor extract --config config.yaml /home/yamadatt/git/ameblo_url_list/interi20250915.txt\n" +
+			"         regex-extractor replace -c html_clean.yaml webpage.html\n" +
+			"         regex-extractor validate -c config.yaml",
+		msgCommandUsage:           "Usage: regex-extractor %s [options] %s\n\n%s\n",
+		msgOptionsHeader:          "Options:",
+		msgArgInputFile:           "<input file>",
+		msgArgText:                "[text]",
+		msgCmdExtract:             "extract and print strings matching the patterns",
+		msgCmdReplace:             "replace matches and save to <name>_replaced.<ext>",
+		msgCmdValidate:            "load the config file and check every regular expression",
+		msgCmdTest:                "apply the patterns to text from an argument or stdin and print the result",
+		msgCmdVersion:             "print the version",
+		msgCmdHelp:                "print this help",
+		msgFlagConfig:             "path to a config file (repeatable; later files take precedence)",
+		msgFlagLang:               "message language (ja|en); defaults to LC_ALL/LANG",
+		msgFlagPattern:            "regular expression to use instead of a config file",
+		msgFlagReplacement:        "replacement string used with --pattern",
+		msgUnknownCommand:         "unknown command: %s",
+		msgMissingInput:           "an input file path is required",
+		msgTooManyArgs:            "too many arguments: %s",
+		msgStdinReadError:         "failed to read standard input: %w",
+		msgValidateOK:             "config file is valid: %d patterns\n",
+		msgValidateFailed:         "%d patterns are invalid",
+		msgReplacedHeader:         "=== Replaced text ===",
+		msgCmdConfig:              "show the effective config (merged result and where each pattern came from)",
+		msgArgConfigSub:           "show",
+		msgConfigNotFound:         "no config file found (use --config, %[3]s, %[2]s or %[1]s in the current directory)",
+		msgConfigShowLayers:       "# loaded config files (lowest precedence first):",
+		msgConfigShowSource:       "from: %s",
+		msgIncludeCycle:           "include cycle detected: %s",
+		msgPatternNameConflict:    "duplicate pattern name '%s' (%s and %s)",
+		msgUnknownPatternRef:      "referenced pattern '%s' is not defined in any included file (%s)",
+		msgInvalidPatternRef:      "a pattern using '%s' may only set description, replacement, replace_template, enabled and tags (%s)",
+		msgIncludeGlobError:       "invalid include pattern (%s): %w",
+		msgCmdPresets:             "list built-in presets (list) or print one (show <name>)",
+		msgArgPresetsSub:          "list | show <name>",
+		msgFlagPreset:             "use a built-in preset (repeatable)",
+		msgUnknownPreset:          "unknown preset: %s (see presets list)",
+		msgConfigShowTemplate:     "before expansion: %s",
+		msgDefinitionUndefined:    "reference to undefined name: {{%s}}",
+		msgDefinitionCycle:        "circular reference in definitions: %s",
+		msgDefinitionTooDeep:      "definitions nested too deeply (limit %d levels): %s",
+		msgPatternExpandError:     "failed to expand pattern '%s': %w",
+		msgFlagVar:                "value for ${var:key} in replacements, as key=value (repeatable)",
+		msgInvalidVar:             "--var must be in key=value form: %s",
+		msgMissingVariables:       "variables referenced in replacements are not provided: %s",
+		msgMalformedPlaceholder:   "invalid replacement in pattern '%s': %w",
+		msgUnclosedPlaceholder:    "unclosed placeholder: %s",
+		msgEmptyPlaceholder:       "empty placeholder name: %s",
+		msgTemplateError:          "replace template error ('%s'): %v\n",
+		msgUnknownPatternType:     "unknown type: %s (use regex, literal, wordlist, dictionary or html-remove)",
+		msgEmptyLiteral:           "empty pattern for type: literal",
+		msgWordlistEmpty:          "pattern '%s' needs strings in words or words_file",
+		msgWordsFileReadError:     "failed to read word list: %w",
+		msgWordlistError:          "word list error ('%s'): %v\n",
+		msgDictionaryMissing:      "pattern '%s' needs a lookup table file in dictionary",
+		msgDictionaryReadError:    "failed to read lookup table: %w",
+		msgDictionaryFormat:       "unknown lookup table format: %s (use a .csv, .tsv or .yaml file)",
+		msgDictionaryColumns:      "%s:%d: a key and a value column are required",
+		msgDictionaryEmptyKey:     "%s:%d: empty key",
+		msgDictionaryDuplicateKey: "%s:%d: duplicate key '%s'",
+		msgDictionaryError:        "lookup table error ('%s'): %v\n",
+		msgDictionaryHit:          "    %s → %s: %d\n",
+		msgEntryStatsLine:         "    %s: %d matches\n",
+		msgFlagOnly:               "use only the named patterns (comma-separated; also enables patterns with enabled: false)",
+		msgFlagSkip:               "do not use the named patterns (comma-separated)",
+		msgFlagTags:               "use only patterns having any of the tags (comma-separated)",
+		msgUnknownPatternName:     "no pattern named in --%s: %s",
+		msgUnknownTag:             "no pattern has the tags given in --tags: %s",
+		msgConditionSkipped:       "[%s] skipped because the when condition is not met\n",
+		msgUnknownConditionRef:    "when.matched of pattern '%s' refers to '%s', which is not an earlier pattern",
+		msgStageStatsHeader:       "=== Statistics by stage ===",
+		msgStageStatsLine:         "%-15s: %d replacements\n",
+		msgConfigShowStage:        "stage: %s",
+		msgScopeInvalid:           "scope needs exactly one of inside and outside",
+		msgScopeError:             "scope/target/markdown error ('%s'): %v\n",
+		msgNegativeLimit:          "max_matches and max_replacements must not be negative",
+		msgLimitError:             "limit error ('%s'): %v\n",
+		msgFlagMaxCount:           "maximum total number of matches to extract or replace per file (0 for no limit)",
+		msgNegativeMaxCount:       "--max-count must not be negative: %d",
+		msgFlagEncoding:           "character encoding of the input file (auto, utf-8, shift_jis, euc-jp)",
+		msgFlagOutputEncoding:     "character encoding of the replaced output (same as the input by default; utf-8, shift_jis, euc-jp)",
+		msgUnknownEncoding:        "unsupported encoding: %s (use utf-8, shift_jis or euc-jp)",
+		msgDetectedEncoding:       "detected the encoding of %s as %s\n",
+		msgDecodeFailed:           "failed to convert from %s: %w",
+		msgEncodeFailed:           "some characters cannot be represented in %s (use --output-encoding utf-8): %w",
+		msgFlagNormalizeNewlines:  "convert CRLF line endings to LF before matching (the replaced output keeps the original line endings)",
+		msgFlagGzip:               "compress the replaced output with gzip (adds .gz to the file name)",
+		msgDecompressFailed:       "failed to decompress %s: %w",
+		msgArchiveReadError:       "failed to read archive (%s): %w",
+		msgArchiveWriteError:      "failed to write archive (%s): %w",
+		msgArchiveMember:          "--- %s ---\n",
+		msgMatchLineInFile:        "[%s] %s:%d:\n",
+		msgFlagBinary:             "how to handle binary files (skip, text: extract as text, error)",
+		msgUnknownBinaryMode:      "--binary must be skip, text or error: %s",
+		msgBinarySkipped:          "skipped binary file: %s\n",
+		msgBinaryNotSaved:         "not saving the replaced output of a binary file: %s\n",
+		msgBinaryInput:            "binary file: %s (use --binary=text to treat it as text)",
+		msgTargetInvalid:          "target must be text, attribute:NAME or tag:NAME: %s",
+		msgSelectorInvalid:        "cannot parse selector (use tag, #id, .class and [attr=value] separated by spaces): '%s'",
+		msgSelectorError:          "selector error ('%s'): %v\n",
+		msgFieldError:             "field error ('%s'): %v\n",
+		msgFieldUnsupportedInput:  "field can only be used with .csv, .tsv, .jsonl and .ndjson files",
+		msgFieldUnsupportedType:   "field cannot be used with type: %s",
+		msgFieldNotFound:          "no such column in the header: %s",
+		msgFieldJSONError:         "cannot parse JSON on line %d: %v",
+		msgFieldInvalidTSV:        "the replaced value of record %d contains a tab or newline and cannot be written as TSV",
+		msgMatchField:             "[%s] line %d (record %d, field %s):\n",
+		msgMatchFieldInFile:       "[%s] %s:%d (record %d, field %s):\n",
+		msgMarkdownInvalid:        "markdown needs exactly one of include and exclude",
+		msgMarkdownUnknownKind:    "unknown Markdown segment: %s (use prose, code_block, inline_code, front_matter or link_url)",
+		msgFlagURLs:               "normalize matches as URLs and print the deduplicated list (counts per host go to stderr)",
+		msgFlagURLDepth:           "number of path directories used to group URLs with --urls",
+		msgNegativeURLDepth:       "--url-depth must be 0 or greater: %d",
+		msgURLNotAbsolute:         "not a URL with a scheme and host: %s",
+		msgURLHostHeader:          "=== Counts per host ===\n",
+		msgURLHostLine:            "%s: %d (%d unique)\n",
+		msgURLPrefixLine:          "  %s: %d (%d unique)\n",
+		msgURLInvalid:             "cannot parse as a URL: %s\n",
+		msgURLTotal:               "URLs: %d (%d unique, %d unparsable)\n",
+		msgConfigLoadError:        "failed to load config file: %w",
+		msgFileReadError:          "failed to read file: %w",
+		msgFileSaveError:          "failed to save file: %w",
+		msgSavedOutput:            "Saved replaced output: %s\n",
+		msgRegexError:             "regex error ('%s'): %v\n",
+		msgConfigReadFailed:       "failed to read config file: %w",
+		msgYAMLParseError:         "YAML parse error: %w",
+		msgReplacedCount:          "[%s] replaced %d occurrences\n",
+		msgTotalReplacements:      "Total replacements: %d\n",
+		msgResultsHeader:          "\n=== Extraction results ===\n",
+		msgTotalMatches:           "Total matches: %d\n\n",
+		msgMatchLine:              "[%s] line %d:\n",
+		msgStatsHeader:            "=== Statistics by pattern ===",
+		msgStatsLine:              "%-15s: %d matches (%s)\n",
+		msgUnknownLang:            "unsupported language: %s (use ja or en)",
+	},
+}
+
+// msg は現在の言語でメッセージを返す。翻訳がない場合は日本語にフォールバックする
+func msg(key string) string {
+	if s, ok := catalog[currentLang][key]; ok {
+		return s
+	}
+	return catalog[langJapanese][key]
+}
+
+// msgf はmsgの結果を書式文字列として扱い、引数を埋め込む
+func msgf(key string, args ...interface{}) string {
+	return fmt.Sprintf(msg(key), args...)
+}
+
+// msgErrorf はmsgの結果を書式文字列としてエラーを生成する（%wによるラップに対応）
+func msgErrorf(key string, args ...interface{}) error {
+	return fmt.Errorf(msg(key), args...)
+}
+
+// parseLang は"en"や"ja_JP.UTF-8"のような値から対応する言語を返す
+func parseLang(value string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case strings.HasPrefix(value, langJapanese):
+		return langJapanese, true
+	case strings.HasPrefix(value, langEnglish):
+		return langEnglish, true
+	}
+	return "", false
+}
+
+// detectLang はLC_ALL、LANGの順に環境変数を調べて言語を決定する
+func detectLang(getenv func(string) string) string {
+	for _, name := range []string{"LC_ALL", "LANG"} {
+		value := getenv(name)
+		if value == "" {
+			continue
+		}
+		if lang, ok := parseLang(value); ok {
+			return lang
+		}
+		// 設定されているが未対応の値（C、POSIXなど）の場合は既定の言語を使う
+		return langJapanese
+	}
+	return langJapanese
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalog_AllKeysTranslated(t *testing.T) {
+	for key := range catalog[langJapanese] {
+		require.Contains(t, catalog[langEnglish], key, "missing English message: %s", key)
+	}
+	for key := range catalog[langEnglish] {
+		require.Contains(t, catalog[langJapanese], key, "missing Japanese message: %s", key)
+	}
+}
+
+func TestDetectLang(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{
+			name:     "no environment",
+			env:      map[string]string{},
+			expected: langJapanese,
+		},
+		{
+			name:     "LANG english",
+			env:      map[string]string{"LANG": "en_US.UTF-8"},
+			expected: langEnglish,
+		},
+		{
+			name:     "LANG japanese",
+			env:      map[string]string{"LANG": "ja_JP.UTF-8"},
+			expected: langJapanese,
+		},
+		{
+			name:     "LC_ALL overrides LANG",
+			env:      map[string]string{"LC_ALL": "en_GB.UTF-8", "LANG": "ja_JP.UTF-8"},
+			expected: langEnglish,
+		},
+		{
+			name:     "unsupported locale falls back to default",
+			env:      map[string]string{"LANG": "C.UTF-8"},
+			expected: langJapanese,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(name string) string { return tt.env[name] }
+			require.Equal(t, tt.expected, detectLang(getenv))
+		})
+	}
+}
+
+func TestMsgf_English(t *testing.T) {
+	currentLang = langEnglish
+	defer func() { currentLang = langJapanese }()
+
+	require.Equal(t, "[urls] replaced 3 occurrences\n", msgf(msgReplacedCount, "urls", 3))
+	require.Equal(t, "Total matches: 2\n\n", msgf(msgTotalMatches, 2))
+}
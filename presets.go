@@ -0,0 +1,50 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// presetPrefix は include でプリセットを指定するときの接頭辞（include: preset:urls）
+const presetPrefix = "preset:"
+
+//go:embed presets/*.yaml
+var presetFS embed.FS
+
+// presetNames は組み込みプリセットの名前を名前順に返す
+func presetNames() []string {
+	entries, err := fs.ReadDir(presetFS, "presets")
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".yaml"); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readPreset は組み込みプリセットのYAMLを返す
+func readPreset(name string) ([]byte, error) {
+	data, err := presetFS.ReadFile(path.Join("presets", name+".yaml"))
+	if err != nil {
+		return nil, msgErrorf(msgUnknownPreset, name)
+	}
+	return data, nil
+}
+
+// parsePreset は組み込みプリセットを設定として読み込む
+func parsePreset(name string) (*Config, error) {
+	data, err := readPreset(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigData(data)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresets_AllValid(t *testing.T) {
+	names := presetNames()
+	require.NotEmpty(t, names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			config, err := parsePreset(name)
+			require.NoError(t, err)
+			require.NotEmpty(t, config.Description)
+			require.NotEmpty(t, config.Patterns)
+			for _, pattern := range config.Patterns {
+				_, err := compilePattern(pattern)
+				require.NoError(t, err, pattern.Name)
+			}
+		})
+	}
+}
+
+func TestPresets_Matches(t *testing.T) {
+	tests := []struct {
+		preset   string
+		text     string
+		expected []string
+	}{
+		{
+			preset:   "urls",
+			text:     `リンク: https://ameblo.jp/interi/entry-123.html と "http://example.com/a?b=c"`,
+			expected: []string{"https://ameblo.jp/interi/entry-123.html", "http://example.com/a?b=c"},
+		},
+		{
+			preset:   "emails",
+			text:     "連絡先: info@example.co.jp / sales.team+jp@mail.example.com",
+			expected: []string{"info@example.co.jp", "sales.team+jp@mail.example.com"},
+		},
+		{
+			preset:   "ipv4",
+			text:     "from 192.168.1.105 to 10.0.0.1, not 999.1.1.1",
+			expected: []string{"192.168.1.105", "10.0.0.1"},
+		},
+		{
+			preset:   "ipv6",
+			text:     "2001:0db8:85a3:0000:0000:8a2e:0370:7334 2001:db8::1 fe80::1:2 ::1",
+			expected: []string{"2001:0db8:85a3:0000:0000:8a2e:0370:7334", "2001:db8::1", "fe80::1:2", "::1"},
+		},
+		{
+			preset:   "html-cleanup",
+			text:     "<p style=\"color: red\">a</p><script>\nalert(1)\n</script><!-- memo -->",
+			expected: []string{"<script>\nalert(1)\n</script>", "<!-- memo -->", ` style="color: red"`},
+		},
+		{
+			preset:   "japanese-dates",
+			text:     "令和元年5月1日と2024年1月15日",
+			expected: []string{"令和元年5月1日", "2024年1月15日"},
+		},
+		{
+			preset:   "timestamps",
+			text:     "2024-01-15 10:23:45 start\n2024-01-15T10:23:46.123+09:00 end",
+			expected: []string{"2024-01-15 10:23:45", "2024-01-15T10:23:46.123+09:00"},
+		},
+		{
+			preset:   "log-levels",
+			text:     "INFO ok\n2024-01-15 ERROR: failed\nWARN: slow\n",
+			expected: []string{"2024-01-15 ERROR: failed", "WARN: slow"},
+		},
+		{
+			preset:   "blank-lines",
+			text:     "a\n\n  \nb\n",
+			expected: []string{"\n", "  \n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			config, err := parsePreset(tt.preset)
+			require.NoError(t, err)
+
+			var texts []string
+			for _, match := range extractMatches(tt.text, config) {
+				texts = append(texts, match.Text)
+			}
+			require.Equal(t, tt.expected, texts)
+		})
+	}
+}
+
+func TestLoadConfig_IncludePreset(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configFile, `include:
+  - preset:urls
+patterns:
+  - use: url
+    replacement: '<URL>'`)
+
+	config, err := loadConfig(configFile)
+	require.NoError(t, err)
+	require.Len(t, config.Patterns, 1)
+	require.Equal(t, "preset:urls", config.Patterns[0].Source)
+	require.Equal(t, "see <URL>", performReplacements("see https://example.com", config))
+
+	writeFile(t, configFile, "include: [preset:unknown]\npatterns: []")
+	_, err = loadConfig(configFile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "不明なプリセットです: unknown")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Scope はパターンを適用する領域（scope:）。
+// 正規表現にマッチした領域の内側（inside）または外側（outside）だけでパターンを照合する。
+// 正規表現にグループがある場合は最初のグループの範囲を領域とする
+type Scope struct {
+	Inside  string `yaml:"inside,omitempty"`
+	Outside string `yaml:"outside,omitempty"`
+}
+
+// compile は領域の正規表現を compilePattern と同じく (?s) 付きでコンパイルする
+func (s *Scope) compile() (*regexp.Regexp, error) {
+	if (s.Inside == "") == (s.Outside == "") {
+		return nil, msgErrorf(msgScopeInvalid)
+	}
+	expr := s.Inside
+	if expr == "" {
+		expr = s.Outside
+	}
+	return regexp.Compile("(?s)" + expr)
+}
+
+// segments は text のうちパターンを照合する範囲 [開始, 終了] を先頭から順に返す
+func (s *Scope) segments(text string) ([][]int, error) {
+	region, err := s.compile()
+	if err != nil {
+		return nil, err
+	}
+	group := 0
+	if region.NumSubexp() > 0 {
+		group = 1
+	}
+
+	var regions [][]int
+	for _, loc := range region.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[2*group], loc[2*group+1]
+		if start < 0 || start == end {
+			continue
+		}
+		regions = append(regions, []int{start, end})
+	}
+	if s.Inside != "" {
+		return regions, nil
+	}
+
+	var outside [][]int
+	prev := 0
+	for _, r := range regions {
+		if r[0] > prev {
+			outside = append(outside, []int{prev, r[0]})
+		}
+		prev = r[1]
+	}
+	if prev < len(text) {
+		outside = append(outside, []int{prev, len(text)})
+	}
+	return outside, nil
+}
+
+// segmented は pattern を text 全体ではなく patternSegments の範囲で照合するかどうかを返す
+func (p Pattern) segmented() bool {
+	return p.Scope != nil || p.Target != "" || p.Markdown != nil || p.PerLine
+}
+
+// patternRegions は text のうち pattern を照合する範囲を返す。target があれば HTML のその部分に、
+// markdown があれば Markdown のその区分に、scope があればその領域に限定する。nil は text 全体を表す
+func patternRegions(pattern Pattern, text string) ([][]int, error) {
+	if pattern.Scope == nil && pattern.Target == "" && pattern.Markdown == nil {
+		return nil, nil
+	}
+	segments := [][]int{{0, len(text)}}
+	if pattern.Target != "" {
+		var err error
+		if segments, err = targetSegments(pattern.Target, text); err != nil {
+			return nil, err
+		}
+	}
+	if pattern.Markdown != nil {
+		regions, err := pattern.Markdown.segments(text)
+		if err != nil {
+			return nil, err
+		}
+		segments = intersectSegments(segments, regions)
+	}
+	if pattern.Scope != nil {
+		regions, err := pattern.Scope.segments(text)
+		if err != nil {
+			return nil, err
+		}
+		segments = intersectSegments(segments, regions)
+	}
+	return segments, nil
+}
+
+// patternSegments は patternRegions の範囲を返し、per_line の場合はさらに行（改行を除く）ごとに分ける。
+// nil は text 全体を表す
+func patternSegments(pattern Pattern, text string) ([][]int, error) {
+	segments, err := patternRegions(pattern, text)
+	if err != nil || !pattern.PerLine {
+		return segments, err
+	}
+	if segments == nil {
+		segments = [][]int{{0, len(text)}}
+	}
+
+	var lines [][]int
+	for _, seg := range segments {
+		lines = append(lines, lineSegments(text, seg[0], seg[1])...)
+	}
+	return lines, nil
+}
+
+// lineSegments は text の [start, end) を行（改行を除く）ごとの範囲に分ける
+func lineSegments(text string, start, end int) [][]int {
+	var lines [][]int
+	for start <= end {
+		i := strings.IndexByte(text[start:end], '\n')
+		if i < 0 {
+			if start < end {
+				lines = append(lines, []int{start, end})
+			}
+			break
+		}
+		lines = append(lines, []int{start, start + i})
+		start += i + 1
+	}
+	return lines
+}
+
+// findInSegments は patternSegments の範囲ごとに find を呼び、マッチの位置を text 全体での位置に直して返す。
+// 各範囲は独立したテキストとして照合するため、マッチが範囲の境界をまたぐことはない。
+// limit が正の場合は、per_line でなければ limit 件見つけた時点で照合をやめる
+func findInSegments(pattern Pattern, text string, find func(string) [][]int, limit int) ([][]int, error) {
+	return findInSegmentsWith(pattern, text, find, nil, limit)
+}
+
+// findRegexInSegments は findInSegments と同じく範囲ごとに regex を照合する。
+// 範囲の先頭から始まるマッチと末尾で終わるマッチは範囲の外の前後の文字を含めて照合し直し、
+// ^、$、\b などが範囲の境界ではなく text 全体（per_line の場合は行）での意味でマッチするようにする
+func findRegexInSegments(pattern Pattern, text string, regex *regexp.Regexp, limit int) ([][]int, error) {
+	return findInSegmentsWith(pattern, text, func(segment string) [][]int {
+		return regex.FindAllStringSubmatchIndex(segment, -1)
+	}, contextFor(regex), limit)
+}
+
+func findInSegmentsWith(pattern Pattern, text string, find func(string) [][]int, ctx *regionContext, limit int) ([][]int, error) {
+	segments, err := patternSegments(pattern, text)
+	if err != nil {
+		return nil, err
+	}
+	if segments == nil {
+		return find(text), nil
+	}
+
+	var locs [][]int
+	for _, seg := range segments {
+		if limit > 0 && !pattern.PerLine && len(locs) >= limit {
+			break
+		}
+		locs = append(locs, ctx.findInRegion(text, seg[0], seg[1], find, pattern.PerLine)...)
+	}
+	return locs, nil
+}
+
+// regionContext は範囲の境界にかかるマッチを、範囲の外の1文字を前後に付けて照合し直すための正規表現
+type regionContext struct {
+	// left は \A(?s:.)(?:regex)。直前の1文字に続けて regex を照合する
+	left *regexp.Regexp
+	// right は \A(?:regex)(?s:.)\z、both は \A(?s:.)(?:regex)(?s:.)\z。マッチが直後の1文字の手前で終われるか確かめる
+	right, both *regexp.Regexp
+}
+
+// regionContexts は正規表現ごとの regionContext（作れない場合は nil）
+var regionContexts sync.Map
+
+// contextFor は regex の regionContext を返す。構文木から式を組み立て直すため、
+// \Q...\E のように後ろに付け足すと意味が変わるパターンでも使える
+func contextFor(regex *regexp.Regexp) *regionContext {
+	if ctx, ok := regionContexts.Load(regex); ok {
+		return ctx.(*regionContext)
+	}
+	var ctx *regionContext
+	if tree, err := syntax.Parse(regex.String(), syntax.Perl); err == nil {
+		expr := "(?:" + tree.String() + ")"
+		left, errLeft := regexp.Compile(`\A(?s:.)` + expr)
+		right, errRight := regexp.Compile(`\A` + expr + `(?s:.)\z`)
+		both, errBoth := regexp.Compile(`\A(?s:.)` + expr + `(?s:.)\z`)
+		if errLeft == nil && errRight == nil && errBoth == nil && left.NumSubexp() == regex.NumSubexp() {
+			ctx = &regionContext{left: left, right: right, both: both}
+		}
+	}
+	regionContexts.Store(regex, ctx)
+	return ctx
+}
+
+// findInRegion は text の [start, end) を find で照合し、text 全体での位置を返す。
+// ctx があれば、範囲の先頭のマッチのうち直前の文字を含めると成り立たないものは1文字ずつずらして探し直し、
+// 範囲の末尾で終わるマッチのうち直後の文字を含めると成り立たないものは取り除く
+func (ctx *regionContext) findInRegion(text string, start, end int, find func(string) [][]int, perLine bool) [][]int {
+	// per_line の行の先頭と末尾は text の先頭と末尾と同じに扱う
+	openLeft := func(pos int) bool {
+		return ctx != nil && pos > 0 && !(perLine && text[pos-1] == '\n')
+	}
+
+	var locs [][]int
+	for {
+		found := find(text[start:end])
+		for _, loc := range found {
+			for j := range loc {
+				if loc[j] >= 0 {
+					loc[j] += start
+				}
+			}
+		}
+		if len(found) == 0 || found[0][0] != start || !openLeft(start) {
+			locs = append(locs, found...)
+			break
+		}
+
+		first := ctx.matchAt(text, start, end)
+		if first != nil && first[1] == found[0][1] {
+			// 直前の文字を含めても同じマッチになるので、続くマッチもそのまま使える
+			found[0] = first
+			locs = append(locs, found...)
+			break
+		}
+		if start == end {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(text[start:end])
+		next := start + size
+		if first != nil {
+			locs = append(locs, first)
+			next = max(next, first[1])
+		}
+		start = next
+	}
+
+	if n := len(locs); n > 0 && ctx != nil && locs[n-1][1] == end && end < len(text) && !(perLine && text[end] == '\n') {
+		if !ctx.endsAt(text, locs[n-1][0], end, openLeft(locs[n-1][0])) {
+			locs = locs[:n-1]
+		}
+	}
+	return locs
+}
+
+// matchAt は直前の1文字を含めて text の [start, end) の先頭から照合し、マッチの位置（なければ nil）を返す
+func (ctx *regionContext) matchAt(text string, start, end int) []int {
+	_, size := utf8.DecodeLastRuneInString(text[:start])
+	from := start - size
+	loc := ctx.left.FindStringSubmatchIndex(text[from:end])
+	if loc == nil {
+		return nil
+	}
+	for j := range loc {
+		if loc[j] >= 0 {
+			loc[j] += from
+		}
+	}
+	loc[0] = start
+	return loc
+}
+
+// endsAt は [start, end) のマッチが、直後の1文字（withLeft なら直前の1文字も）を含めても成り立つかどうかを返す
+func (ctx *regionContext) endsAt(text string, start, end int, withLeft bool) bool {
+	_, size := utf8.DecodeRuneInString(text[end:])
+	if !withLeft {
+		return ctx.right.MatchString(text[start : end+size])
+	}
+	_, before := utf8.DecodeLastRuneInString(text[:start])
+	return ctx.both.MatchString(text[start-before : end+size])
+}
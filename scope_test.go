@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScope_Segments(t *testing.T) {
+	text := "a<pre>b</pre>c<pre></pre>d"
+
+	tests := []struct {
+		name        string
+		scope       Scope
+		expected    []string
+		errContains string
+	}{
+		{name: "inside", scope: Scope{Inside: `<pre>.*?</pre>`}, expected: []string{"<pre>b</pre>", "<pre></pre>"}},
+		{name: "inside group", scope: Scope{Inside: `<pre>(.*?)</pre>`}, expected: []string{"b"}},
+		{name: "outside", scope: Scope{Outside: `<pre>.*?</pre>`}, expected: []string{"a", "c", "d"}},
+		{name: "outside without regions", scope: Scope{Outside: `<code>`}, expected: []string{text}},
+		{name: "both", scope: Scope{Inside: "a", Outside: "b"}, errContains: "どちらか一方"},
+		{name: "neither", scope: Scope{}, errContains: "どちらか一方"},
+		{name: "invalid regex", scope: Scope{Inside: "("}, errContains: "missing closing )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments, err := tt.scope.segments(text)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, seg := range segments {
+				got = append(got, text[seg[0]:seg[1]])
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestPerformReplacements_Scope(t *testing.T) {
+	html := "<p>a   b</p>\n<pre>x   y</pre>\n<p>c  d</p>"
+
+	tests := []struct {
+		name     string
+		pattern  Pattern
+		text     string
+		expected string
+	}{
+		{
+			name:     "outside pre",
+			pattern:  Pattern{Name: "spaces", Pattern: ` {2,}`, Replacement: " ", Scope: &Scope{Outside: `<pre>.*?</pre>`}},
+			text:     html,
+			expected: "<p>a b</p>\n<pre>x   y</pre>\n<p>c d</p>",
+		},
+		{
+			name:     "inside pre",
+			pattern:  Pattern{Name: "spaces", Pattern: ` {2,}`, Replacement: " ", Scope: &Scope{Inside: `<pre>.*?</pre>`}},
+			text:     html,
+			expected: "<p>a   b</p>\n<pre>x y</pre>\n<p>c  d</p>",
+		},
+		{
+			name:     "inside body group",
+			pattern:  Pattern{Name: "link", Pattern: `http://`, Replacement: "https://", Scope: &Scope{Inside: `<body>(.*)</body>`}},
+			text:     `<head>http://a</head><body>http://b</body>`,
+			expected: `<head>http://a</head><body>https://b</body>`,
+		},
+		{
+			name:     "anchors keep their meaning in the whole text",
+			pattern:  Pattern{Name: "indent", Pattern: `(?m)^ +`, Replacement: "", Scope: &Scope{Outside: `<pre>.*?</pre>`}},
+			text:     "  a <pre>x</pre>   keep spaces\n  b",
+			expected: "a <pre>x</pre>   keep spaces\nb",
+		},
+		{
+			name:     "word boundary at the region edge",
+			pattern:  Pattern{Name: "word", Pattern: `\bkeep`, Replacement: "KEEP", Scope: &Scope{Outside: `#\d+`}},
+			text:     "#12keep keep",
+			expected: "#12keep KEEP",
+		},
+		{
+			name:     "matches crossing the region edge are skipped",
+			pattern:  Pattern{Name: "ab", Pattern: `a b`, Replacement: "X", Scope: &Scope{Inside: `<p>(.*?)</p>`}},
+			text:     "<p>a</p> b <p>a b</p>",
+			expected: "<p>a</p> b <p>X</p>",
+		},
+		{
+			name:     "wordlist",
+			pattern:  Pattern{Name: "ng", Type: patternTypeWordlist, Words: []string{"foo"}, Replacement: "***", Scope: &Scope{Outside: "`[^`]*`"}},
+			text:     "foo `foo` foo",
+			expected: "*** `foo` ***",
+		},
+		{
+			name:     "greedy match is bounded by the region",
+			pattern:  Pattern{Name: "title", Pattern: `\S+`, Replacement: "X", Scope: &Scope{Inside: `<title>(.*?)</title>`}},
+			text:     "<title>Hello</title>",
+			expected: "<title>X</title>",
+		},
+		{
+			name:     "greedy match before an excluded region",
+			pattern:  Pattern{Name: "upper", Pattern: `.+`, ReplaceTemplate: `{{upper .Match}}`, Scope: &Scope{Outside: `<pre>.*?</pre>`}},
+			text:     "ab<pre>cd</pre>ef",
+			expected: "AB<pre>cd</pre>EF",
+		},
+		{
+			name:     "invalid scope leaves the text as is",
+			pattern:  Pattern{Name: "bad", Pattern: `a`, Replacement: "b", Scope: &Scope{}},
+			text:     "aaa",
+			expected: "aaa",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Patterns: []Pattern{tt.pattern}}
+			require.Equal(t, tt.expected, performReplacements(tt.text, config))
+		})
+	}
+}
+
+func TestPerformReplacements_ScopeDictionary(t *testing.T) {
+	dictFile := filepath.Join(t.TempDir(), "terms.csv")
+	require.NoError(t, os.WriteFile(dictFile, []byte("color,colour\n"), 0644))
+
+	config := &Config{Patterns: []Pattern{{
+		Name:       "terms",
+		Type:       patternTypeDictionary,
+		Dictionary: dictFile,
+		Scope:      &Scope{Outside: `<code>.*?</code>`},
+	}}}
+	require.Equal(t, "colour <code>color</code> colour", performReplacements("color <code>color</code> color", config))
+}
+
+func TestExtractMatches_ScopeLineNumbers(t *testing.T) {
+	text := "TODO top\n<pre>\nTODO in pre\n</pre>\nTODO bottom\n"
+	config := &Config{Patterns: []Pattern{
+		{Name: "todo", Pattern: `TODO \w+`, Scope: &Scope{Outside: `<pre>.*?</pre>`}},
+		{Name: "pre-todo", Pattern: `TODO`, Scope: &Scope{Inside: `<pre>.*?</pre>`}},
+	}}
+
+	matches := extractMatches(text, config)
+	require.Len(t, matches, 3)
+	require.Equal(t, Match{PatternName: "todo", Line: 1, Text: "TODO top", Matches: []string{"TODO top"}}, matches[0])
+	require.Equal(t, Match{PatternName: "todo", Line: 5, Text: "TODO bottom", Matches: []string{"TODO bottom"}}, matches[1])
+	require.Equal(t, Match{PatternName: "pre-todo", Line: 3, Text: "TODO", Matches: []string{"TODO"}}, matches[2])
+}
+
+func TestRun_ValidateScope(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "spaces"
+    pattern: ' +'
+    replacement: ' '
+    scope:
+      outside: '<pre>.*?</pre>'`), 0644))
+	require.Equal(t, exitOK, run([]string{"validate", "-c", configFile}))
+
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "spaces"
+    pattern: ' +'
+    replacement: ' '
+    scope:
+      inside: '<body>'
+      outside: '<pre>'`), 0644))
+	require.Equal(t, exitError, run([]string{"validate", "-c", configFile}))
+}
+
+func TestExtractMatches_ScopeGreedy(t *testing.T) {
+	config := &Config{Patterns: []Pattern{{Name: "title", Pattern: `\S+`, Scope: &Scope{Inside: `<title>(.*?)</title>`}}}}
+	matches := extractMatches("<head>\n<title>Hello</title>\n</head>", config)
+	require.Len(t, matches, 1)
+	require.Equal(t, 2, matches[0].Line)
+	require.Equal(t, "Hello", matches[0].Text)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// commaList はカンマ区切りで複数の値を受け取り、繰り返しの指定も追加していくフラグ
+type commaList []string
+
+func (l *commaList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *commaList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// patternSelection は --only、--skip、--tags によるパターンの絞り込み
+type patternSelection struct {
+	only commaList
+	skip commaList
+	tags commaList
+}
+
+// apply は絞り込みの条件に合わないパターンを取り除く。
+// --only で名前を指定したパターンは enabled: false でも有効にする。
+// 存在しない名前やどのパターンにも付いていないタグは指定の誤りとしてエラーにする
+func (s *patternSelection) apply(config *Config) error {
+	if len(s.only) == 0 && len(s.skip) == 0 && len(s.tags) == 0 {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	tags := make(map[string]bool)
+	for _, pattern := range config.Patterns {
+		names[pattern.Name] = true
+		for _, tag := range pattern.Tags {
+			tags[tag] = true
+		}
+	}
+	if err := checkSelected("only", s.only, names); err != nil {
+		return err
+	}
+	if err := checkSelected("skip", s.skip, names); err != nil {
+		return err
+	}
+	if err := checkSelected("tags", s.tags, tags); err != nil {
+		return err
+	}
+
+	only := toSet(s.only)
+	skip := toSet(s.skip)
+	wanted := toSet(s.tags)
+
+	var patterns []Pattern
+	for _, pattern := range config.Patterns {
+		if len(only) > 0 && !only[pattern.Name] {
+			continue
+		}
+		if skip[pattern.Name] {
+			continue
+		}
+		if len(wanted) > 0 && !hasAnyTag(pattern, wanted) {
+			continue
+		}
+		if only[pattern.Name] {
+			pattern.Enabled = nil
+		}
+		patterns = append(patterns, pattern)
+	}
+	config.Patterns = patterns
+	return nil
+}
+
+// checkSelected は指定された値がすべて known に含まれているか確かめる
+func checkSelected(flagName string, values []string, known map[string]bool) error {
+	var unknown []string
+	for _, value := range values {
+		if !known[value] {
+			unknown = append(unknown, value)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	if flagName == "tags" {
+		return msgErrorf(msgUnknownTag, strings.Join(unknown, ", "))
+	}
+	return msgErrorf(msgUnknownPatternName, flagName, strings.Join(unknown, ", "))
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func hasAnyTag(pattern Pattern, tags map[string]bool) bool {
+	for _, tag := range pattern.Tags {
+		if tags[tag] {
+			return true
+		}
+	}
+	return false
+}
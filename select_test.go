@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommaList_Set(t *testing.T) {
+	var list commaList
+	require.NoError(t, list.Set("a, b,,c"))
+	require.NoError(t, list.Set("d"))
+	require.Equal(t, commaList{"a", "b", "c", "d"}, list)
+	require.Equal(t, "a,b,c,d", list.String())
+}
+
+func TestPatternSelection_Apply(t *testing.T) {
+	disabled := false
+	newConfig := func() *Config {
+		return &Config{Patterns: []Pattern{
+			{Name: "script", Pattern: "<script", Tags: []string{"html", "cleanup"}},
+			{Name: "comment", Pattern: "<!--", Tags: []string{"html"}},
+			{Name: "error", Pattern: "ERROR", Tags: []string{"log"}},
+			{Name: "debug", Pattern: "DEBUG", Tags: []string{"log"}, Enabled: &disabled},
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		selection   patternSelection
+		expected    []string
+		errContains string
+	}{
+		{
+			name:     "no selection keeps everything",
+			expected: []string{"script", "comment", "error", "debug"},
+		},
+		{
+			name:      "only",
+			selection: patternSelection{only: commaList{"error", "script"}},
+			expected:  []string{"script", "error"},
+		},
+		{
+			name:      "skip",
+			selection: patternSelection{skip: commaList{"comment"}},
+			expected:  []string{"script", "error", "debug"},
+		},
+		{
+			name:      "tags match any",
+			selection: patternSelection{tags: commaList{"cleanup", "log"}},
+			expected:  []string{"script", "error", "debug"},
+		},
+		{
+			name:      "tags and skip",
+			selection: patternSelection{tags: commaList{"html"}, skip: commaList{"script"}},
+			expected:  []string{"comment"},
+		},
+		{
+			name:        "unknown name",
+			selection:   patternSelection{skip: commaList{"scirpt"}},
+			errContains: "--skip で指定したパターンがありません: scirpt",
+		},
+		{
+			name:        "unknown tag",
+			selection:   patternSelection{tags: commaList{"css", "html", "json"}},
+			errContains: "--tags で指定したタグを持つパターンがありません: css, json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newConfig()
+			err := tt.selection.apply(config)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, pattern := range config.Patterns {
+				names = append(names, pattern.Name)
+			}
+			require.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestPatternSelection_OnlyEnablesDisabledPattern(t *testing.T) {
+	disabled := false
+	config := &Config{Patterns: []Pattern{
+		{Name: "debug", Pattern: "DEBUG", Replacement: "-", Enabled: &disabled},
+		{Name: "error", Pattern: "ERROR", Replacement: "E"},
+	}}
+	require.Equal(t, "DEBUG E", performReplacements("DEBUG ERROR", config))
+	require.Empty(t, extractMatches("DEBUG", config))
+
+	require.NoError(t, (&patternSelection{only: commaList{"debug"}}).apply(config))
+	require.Equal(t, "- ERROR", performReplacements("DEBUG ERROR", config))
+}
+
+func TestLoadConfig_UseOverridesEnabledAndTags(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFile(t, filepath.Join(tmpDir, "common.yaml"), `patterns:
+  - name: "trailing-space"
+    pattern: '[ \t]+\n'
+    replacement: "\n"
+    tags: [whitespace]
+  - name: "tab"
+    pattern: '\t'
+    replacement: '    '
+    tags: [whitespace]`)
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configFile, `include:
+  - common.yaml
+patterns:
+  - use: "tab"
+    enabled: false
+  - use: "trailing-space"
+    tags: [cleanup]`)
+
+	config, err := loadConfig(configFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cleanup"}, config.Patterns[0].Tags)
+	require.False(t, config.Patterns[1].isActive())
+	require.Equal(t, "a\tb\n", performReplacements("a\tb  \n", config))
+}
+
+func TestRun_PatternSelection(t *testing.T) {
+	defer func() { currentLang = langJapanese }()
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("<b>bold</b> DEBUG"), 0644))
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`patterns:
+  - name: "tag"
+    pattern: '</?b>'
+    replacement: ''
+    tags: [html]
+  - name: "debug"
+    pattern: 'DEBUG'
+    replacement: ''
+    tags: [log]`), 0644))
+	outputFile := filepath.Join(tmpDir, "input_replaced.txt")
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		expected string
+	}{
+		{name: "tags", args: []string{"--tags", "html"}, exitCode: exitOK, expected: "bold DEBUG"},
+		{name: "skip", args: []string{"--skip=tag"}, exitCode: exitOK, expected: "<b>bold</b> "},
+		{name: "only", args: []string{"--only", "tag,debug"}, exitCode: exitOK, expected: "bold "},
+		{name: "unknown name", args: []string{"--only", "nothing"}, exitCode: exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(outputFile)
+			args := append([]string{"replace", "-c", configFile, inputFile}, tt.args...)
+			require.Equal(t, tt.exitCode, run(args))
+			if tt.exitCode != exitOK {
+				return
+			}
+			output, err := os.ReadFile(outputFile)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(output))
+		})
+	}
+}
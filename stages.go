@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Stage は順番に実行するパターンのまとまり（stages: の各要素）
+type Stage struct {
+	Name        string    `yaml:"name"`
+	Description string    `yaml:"description,omitempty"`
+	Patterns    []Pattern `yaml:"patterns"`
+}
+
+// Condition はパターンを実行する条件（when:）。指定した条件をすべて満たす場合だけ実行する
+type Condition struct {
+	// Matched はそれより前にあるパターンの名前。そのパターンがマッチした場合だけ実行する
+	Matched string `yaml:"matched,omitempty"`
+	// Extension は入力ファイルの拡張子（.html など）。いずれかに一致する場合だけ実行する
+	Extension []string `yaml:"extension,omitempty"`
+	// Contains は入力に含まれている必要がある文字列
+	Contains string `yaml:"contains,omitempty"`
+}
+
+// conditionState は when の評価に使う入力の情報と、それまでに実行したパターンの結果
+type conditionState struct {
+	inputFile string
+	input     string
+	matched   map[string]bool
+}
+
+func newConditionState(inputFile, input string) *conditionState {
+	return &conditionState{inputFile: inputFile, input: input, matched: make(map[string]bool)}
+}
+
+// allows は pattern の when を満たすかどうかを返す（when がなければ常に true）
+func (s *conditionState) allows(pattern Pattern) bool {
+	when := pattern.When
+	if when == nil {
+		return true
+	}
+	if when.Matched != "" && !s.matched[when.Matched] {
+		return false
+	}
+	if len(when.Extension) > 0 && !hasExtension(s.inputFile, when.Extension) {
+		return false
+	}
+	if when.Contains != "" && !strings.Contains(s.input, when.Contains) {
+		return false
+	}
+	return true
+}
+
+// hasExtension は filename の拡張子が extensions のいずれかと一致するかどうかを返す。
+// 先頭の . は省略でき、大文字小文字は区別しない
+func hasExtension(filename string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		return false
+	}
+	for _, want := range extensions {
+		want = strings.ToLower(want)
+		if !strings.HasPrefix(want, ".") {
+			want = "." + want
+		}
+		if ext == want {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenStages は stages の各パターンにステージ名を付けて patterns の後ろに並べる。
+// 名前のないステージには1から始まる番号を付ける
+func flattenStages(config *Config) {
+	for i, stage := range config.Stages {
+		name := stage.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		for _, pattern := range stage.Patterns {
+			pattern.Stage = name
+			config.Patterns = append(config.Patterns, pattern)
+		}
+	}
+	config.Stages = nil
+}
+
+// checkConditions は when.matched がそれより前のパターンを参照しているか確かめる
+func checkConditions(config *Config) error {
+	seen := make(map[string]bool)
+	for _, pattern := range config.Patterns {
+		if pattern.When != nil && pattern.When.Matched != "" && !seen[pattern.When.Matched] {
+			return msgErrorf(msgUnknownConditionRef, pattern.Name, pattern.When.Matched)
+		}
+		seen[pattern.Name] = true
+	}
+	return nil
+}
+
+// stageStats はステージごとの置換数を最初に現れた順に集計する
+type stageStats struct {
+	names  []string
+	counts map[string]int
+}
+
+func (s *stageStats) add(stage string, count int) {
+	if stage == "" {
+		return
+	}
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	if _, ok := s.counts[stage]; !ok {
+		s.names = append(s.names, stage)
+	}
+	s.counts[stage] += count
+}
+
+// print はステージを使っている場合だけステージ別の置換数を表示する
+func (s *stageStats) print() {
+	if len(s.names) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, msg(msgStageStatsHeader))
+	for _, name := range s.names {
+		fmt.Fprint(os.Stderr, msgf(msgStageStatsLine, name, s.counts[name]))
+	}
+}
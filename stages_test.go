@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const pipelineConfig = `patterns:
+  - name: "bom"
+    pattern: '^\x{FEFF}'
+    replacement: ''
+stages:
+  - name: strip
+    patterns:
+      - name: "script"
+        pattern: '<script[^>]*>.*?</script>'
+        replacement: ''
+      - name: "script-note"
+        pattern: '</body>'
+        replacement: '<!-- scripts removed --></body>'
+        when:
+          matched: script
+  - name: whitespace
+    patterns:
+      - name: "spaces"
+        pattern: '[ \t]+'
+        replacement: ' '
+  - name: entities
+    patterns:
+      - name: "nbsp"
+        pattern: '&nbsp;'
+        replacement: ' '
+        when:
+          extension: [html, .htm]
+      - name: "legacy-marker"
+        pattern: 'LEGACY'
+        replacement: 'MODERN'
+        when:
+          contains: '<!-- legacy -->'`
+
+func TestParseConfigData_Stages(t *testing.T) {
+	config, err := parseConfigData([]byte(pipelineConfig))
+	require.NoError(t, err)
+	require.Nil(t, config.Stages)
+
+	var names, stages []string
+	for _, pattern := range config.Patterns {
+		names = append(names, pattern.Name)
+		stages = append(stages, pattern.Stage)
+	}
+	require.Equal(t, []string{"bom", "script", "script-note", "spaces", "nbsp", "legacy-marker"}, names)
+	require.Equal(t, []string{"", "strip", "strip", "whitespace", "entities", "entities"}, stages)
+	require.Equal(t, &Condition{Matched: "script"}, config.Patterns[2].When)
+	require.NoError(t, checkConditions(config))
+
+	config, err = parseConfigData([]byte(`stages:
+  - patterns:
+      - name: "a"
+        pattern: 'a'
+  - patterns:
+      - name: "b"
+        pattern: 'b'`))
+	require.NoError(t, err)
+	require.Equal(t, "1", config.Patterns[0].Stage)
+	require.Equal(t, "2", config.Patterns[1].Stage)
+}
+
+func TestPerformReplacementsInFile_Pipeline(t *testing.T) {
+	config, err := parseConfigData([]byte(pipelineConfig))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		inputFile string
+		text      string
+		expected  string
+	}{
+		{
+			name:      "all stages run for html",
+			inputFile: "page.html",
+			text:      "<p>a  &nbsp;b</p><script>x()</script></body>",
+			expected:  "<p>a  b</p><!-- scripts removed --></body>",
+		},
+		{
+			name:      "conditional step skipped when nothing matched",
+			inputFile: "page.HTM",
+			text:      "<p>a\t\tb</p></body>",
+			expected:  "<p>a b</p></body>",
+		},
+		{
+			name:      "extension condition",
+			inputFile: "notes.txt",
+			text:      "a&nbsp;b",
+			expected:  "a&nbsp;b",
+		},
+		{
+			name:      "marker condition uses the original input",
+			inputFile: "page.html",
+			text:      "<!-- legacy -->LEGACY",
+			expected:  "<!-- legacy -->MODERN",
+		},
+		{
+			name:      "marker missing",
+			inputFile: "page.html",
+			text:      "LEGACY",
+			expected:  "LEGACY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, performReplacementsInFile(tt.text, tt.inputFile, config))
+		})
+	}
+}
+
+func TestExtractMatchesInFile_Conditions(t *testing.T) {
+	config := &Config{Patterns: []Pattern{
+		{Name: "todo", Pattern: `TODO`},
+		{Name: "owner", Pattern: `@\w+`, When: &Condition{Matched: "todo"}},
+		{Name: "go-only", Pattern: `func`, When: &Condition{Extension: []string{"go"}}},
+	}}
+
+	matches := extractMatchesInFile("func f() // TODO @alice", "main.go", config)
+	require.Len(t, matches, 3)
+
+	matches = extractMatchesInFile("func f() @alice", "main.py", config)
+	require.Empty(t, matches)
+}
+
+func TestConditionState_Allows(t *testing.T) {
+	state := newConditionState("/tmp/Page.HTML", "<html><!-- marker -->")
+	state.matched["first"] = true
+	state.matched["second"] = false
+
+	tests := []struct {
+		name     string
+		when     *Condition
+		expected bool
+	}{
+		{name: "no condition", when: nil, expected: true},
+		{name: "matched", when: &Condition{Matched: "first"}, expected: true},
+		{name: "not matched", when: &Condition{Matched: "second"}, expected: false},
+		{name: "unknown pattern", when: &Condition{Matched: "nothing"}, expected: false},
+		{name: "extension case insensitive", when: &Condition{Extension: []string{".html"}}, expected: true},
+		{name: "extension without dot", when: &Condition{Extension: []string{"md", "html"}}, expected: true},
+		{name: "other extension", when: &Condition{Extension: []string{"txt"}}, expected: false},
+		{name: "contains", when: &Condition{Contains: "<!-- marker -->"}, expected: true},
+		{name: "all conditions must hold", when: &Condition{Matched: "first", Contains: "absent"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, state.allows(Pattern{When: tt.when}))
+		})
+	}
+}
+
+func TestCheckConditions(t *testing.T) {
+	config := &Config{Patterns: []Pattern{
+		{Name: "later-ref", Pattern: "a", When: &Condition{Matched: "b"}},
+		{Name: "b", Pattern: "b"},
+	}}
+	err := checkConditions(config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'later-ref'")
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	t.Setenv(configEnvVar, "")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`stages:
+  - name: one
+    patterns:
+      - name: "a"
+        pattern: 'a'
+        when:
+          matched: typo`), 0644))
+	inputFile := filepath.Join(tmpDir, "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("a"), 0644))
+
+	for _, args := range [][]string{
+		{"validate", "-c", configFile},
+		{"extract", "-c", configFile, inputFile},
+		{"replace", "-c", configFile, inputFile},
+		// --skip で除いたパターンの参照の誤りも報告する
+		{"extract", "-c", configFile, "--skip", "a", inputFile},
+	} {
+		require.Equal(t, exitError, run(args), args)
+	}
+	require.NoFileExists(t, filepath.Join(tmpDir, "input_replaced.txt"))
+}
+
+func TestWriteEffectiveConfig_Stage(t *testing.T) {
+	config, err := parseConfigData([]byte(pipelineConfig))
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, writeEffectiveConfig(&out, config, nil))
+	require.Contains(t, out.String(), "# ステージ: whitespace")
+	require.Contains(t, out.String(), "matched: script")
+}
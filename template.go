@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// templateMatch は replace_template の評価時に渡すマッチの情報
+type templateMatch struct {
+	Match  string            // マッチした文字列全体
+	Groups []string          // キャプチャグループ（Groups[0] はマッチ全体）
+	Named  map[string]string // 名前付きグループ
+	N      int               // パターン内で何番目のマッチか（1から）
+}
+
+// templateCounters は counter 関数の値。1回の置換処理の中でパターンをまたいで共有する
+type templateCounters map[string]int
+
+// templateFuncs は replace_template で使える関数
+func templateFuncs(counters templateCounters) template.FuncMap {
+	return template.FuncMap{
+		"upper":     strings.ToUpper,
+		"lower":     strings.ToLower,
+		"title":     titleCase,
+		"trim":      strings.TrimSpace,
+		"pad":       zeroPad,
+		"sha256":    sha256Hex,
+		"short":     shortHash,
+		"urlencode": url.QueryEscape,
+		"urldecode": urlDecode,
+		"hankaku":   width.Narrow.String,
+		"zenkaku":   width.Widen.String,
+		"fold":      width.Fold.String,
+		"counter": func(name ...string) int {
+			key := strings.Join(name, "")
+			counters[key]++
+			return counters[key]
+		},
+	}
+}
+
+// compileReplaceTemplate はパターンの replace_template を解析する
+func compileReplaceTemplate(pattern Pattern, counters templateCounters) (*template.Template, error) {
+	return template.New(pattern.Name).Option("missingkey=error").Funcs(templateFuncs(counters)).Parse(pattern.ReplaceTemplate)
+}
+
+// newTemplateMatch は FindStringSubmatchIndex 形式のマッチ位置からテンプレートに渡す値を作る。
+// n はパターン内で何番目のマッチか（1から）
+func newTemplateMatch(regex *regexp.Regexp, text string, loc []int, n int) templateMatch {
+	groups := make([]string, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] >= 0 {
+			groups[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+
+	data := templateMatch{Match: groups[0], Groups: groups, Named: make(map[string]string), N: n}
+	for i, name := range regex.SubexpNames() {
+		if name != "" {
+			data.Named[name] = groups[i]
+		}
+	}
+	return data
+}
+
+// titleCase は単語の先頭を大文字、それ以外を小文字にする
+func titleCase(s string) string {
+	runes := []rune(strings.ToLower(s))
+	start := true
+	for i, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start {
+				runes[i] = unicode.ToUpper(r)
+			}
+			start = false
+		} else {
+			start = true
+		}
+	}
+	return string(runes)
+}
+
+// zeroPad は値を指定した桁数になるよう先頭を0で埋める（pad 3 .N → 001）
+func zeroPad(digits int, value interface{}) (string, error) {
+	s := fmt.Sprint(value)
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// shortHash はSHA-256の先頭8桁を返す（IDの匿名化など）
+func shortHash(s string) string {
+	return sha256Hex(s)[:8]
+}
+
+// urlDecode はURLエンコードを解除する。解除できない場合は元の文字列を返す
+func urlDecode(s string) string {
+	decoded, err := url.QueryUnescape(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
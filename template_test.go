@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerformReplacements_ReplaceTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		patterns []Pattern
+		expected string
+	}{
+		{
+			name: "renumber footnotes",
+			text: "本文[*]と本文[*]と本文[*]",
+			patterns: []Pattern{
+				{Name: "footnote", Pattern: `\[\*\]`, ReplaceTemplate: `[{{.N}}]`},
+			},
+			expected: "本文[1]と本文[2]と本文[3]",
+		},
+		{
+			name: "case conversion with groups",
+			text: "name: yamada taro",
+			patterns: []Pattern{
+				{Name: "name", Pattern: `name: (\w+) (\w+)`, ReplaceTemplate: `name: {{index .Groups 2 | title}} {{index .Groups 1 | upper}}`},
+			},
+			expected: "name: Taro YAMADA",
+		},
+		{
+			name: "named groups and zero padding",
+			text: "item-7 item-42",
+			patterns: []Pattern{
+				{Name: "item", Pattern: `item-(?P<num>\d+)`, ReplaceTemplate: `ITEM{{pad 4 .Named.num}}`},
+			},
+			expected: "ITEM0007 ITEM0042",
+		},
+		{
+			name: "anonymize ids",
+			text: "user=alice user=bob user=alice",
+			patterns: []Pattern{
+				{Name: "user", Pattern: `user=(\w+)`, ReplaceTemplate: `user={{index .Groups 1 | short}}`},
+			},
+			expected: "user=" + shortHash("alice") + " user=" + shortHash("bob") + " user=" + shortHash("alice"),
+		},
+		{
+			name: "url encoding",
+			text: "q=東京 タワー",
+			patterns: []Pattern{
+				{Name: "query", Pattern: `q=(.+)`, ReplaceTemplate: `q={{index .Groups 1 | urlencode}}`},
+			},
+			expected: "q=%E6%9D%B1%E4%BA%AC+%E3%82%BF%E3%83%AF%E3%83%BC",
+		},
+		{
+			name: "url decoding and trim",
+			text: "[ %E6%9D%B1%E4%BA%AC ]",
+			patterns: []Pattern{
+				{Name: "decode", Pattern: `\[(.*?)\]`, ReplaceTemplate: `{{index .Groups 1 | trim | urldecode}}`},
+			},
+			expected: "東京",
+		},
+		{
+			name: "width normalization",
+			text: "ＡＢＣ１２３ ｶﾀｶﾅ",
+			patterns: []Pattern{
+				{Name: "hankaku", Pattern: `[Ａ-Ｚ０-９]+`, ReplaceTemplate: `{{hankaku .Match}}`},
+				{Name: "zenkaku", Pattern: `[ｦ-ﾟ]+`, ReplaceTemplate: `{{zenkaku .Match}}`},
+			},
+			expected: "ABC123 カタカナ",
+		},
+		{
+			name: "hankaku narrows kana",
+			text: "ｶﾀｶﾅ カタカナ ＡＢＣ",
+			patterns: []Pattern{
+				{Name: "hankaku", Pattern: `.+`, ReplaceTemplate: `{{hankaku .Match}}`},
+			},
+			expected: "ｶﾀｶﾅ ｶﾀｶﾅ ABC",
+		},
+		{
+			name: "fold widens kana and narrows ASCII",
+			text: "ｶﾀｶﾅ ＡＢＣ",
+			patterns: []Pattern{
+				{Name: "fold", Pattern: `.+`, ReplaceTemplate: `{{fold .Match}}`},
+			},
+			expected: "カタカナ ABC",
+		},
+		{
+			name: "counter shared across patterns",
+			text: "注A 注B 注A",
+			patterns: []Pattern{
+				{Name: "a", Pattern: `注A`, ReplaceTemplate: `注{{counter "note"}}`},
+				{Name: "b", Pattern: `注B`, ReplaceTemplate: `注{{counter "note"}}`},
+			},
+			expected: "注1 注3 注2",
+		},
+		{
+			name: "template takes precedence over replacement",
+			text: "abc",
+			patterns: []Pattern{
+				{Name: "both", Pattern: `b`, Replacement: "x", ReplaceTemplate: `{{upper .Match}}`},
+			},
+			expected: "aBc",
+		},
+		{
+			name: "execution error leaves text unchanged",
+			text: "abc",
+			patterns: []Pattern{
+				{Name: "bad", Pattern: `b`, ReplaceTemplate: `{{index .Groups 5}}`},
+			},
+			expected: "abc",
+		},
+		{
+			name: "parse error leaves text unchanged",
+			text: "abc",
+			patterns: []Pattern{
+				{Name: "bad", Pattern: `b`, ReplaceTemplate: `{{upper`},
+			},
+			expected: "abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := performReplacements(tt.text, &Config{Patterns: tt.patterns})
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestZeroPad(t *testing.T) {
+	result, err := zeroPad(3, 7)
+	require.NoError(t, err)
+	require.Equal(t, "007", result)
+
+	result, err = zeroPad(2, "123")
+	require.NoError(t, err)
+	require.Equal(t, "123", result)
+
+	_, err = zeroPad(3, "abc")
+	require.Error(t, err)
+}
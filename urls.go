@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// urlTrackingParams は正規化で取り除く計測用のクエリパラメータ（utm_ で始まるものも取り除く）
+var urlTrackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true, "yclid": true,
+	"igshid": true, "mc_cid": true, "mc_eid": true,
+}
+
+// urlOptions は抽出したマッチを URL として集計する --urls と --url-depth
+type urlOptions struct {
+	enabled bool
+	// depth はパスの接頭辞で集計するときのディレクトリの深さ
+	depth int
+}
+
+// addURLFlags は --urls と --url-depth を登録する
+func addURLFlags(fs *flag.FlagSet) *urlOptions {
+	opts := &urlOptions{}
+	fs.BoolVar(&opts.enabled, "urls", false, msg(msgFlagURLs))
+	fs.IntVar(&opts.depth, "url-depth", 1, msg(msgFlagURLDepth))
+	return opts
+}
+
+// check は --url-depth の値を確かめる
+func (o *urlOptions) check() error {
+	if o.depth < 0 {
+		return &usageError{err: msgErrorf(msgNegativeURLDepth, o.depth)}
+	}
+	return nil
+}
+
+// normalizeURL は raw を net/url で解析して正規化する。スキームとホストを小文字にし、
+// 既定のポート、フラグメント、計測用のクエリパラメータ、パスの末尾の / を取り除く
+func normalizeURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, msgErrorf(msgURLNotAbsolute, raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 のアドレス
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+
+	if u.Path == "" {
+		u.Path = "/"
+	} else if len(u.Path) > 1 {
+		trimmed := strings.TrimRight(u.Path, "/")
+		if trimmed == "" {
+			trimmed = "/"
+		}
+		u.Path = trimmed
+		u.RawPath = strings.TrimRight(u.RawPath, "/")
+	}
+
+	// 元の順序と表記を保ったまま計測用のパラメータだけを取り除く
+	var kept []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(param, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "utm_") || urlTrackingParams[key] {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u, nil
+}
+
+// urlPathPrefix は u のパスの先頭から depth 個のディレクトリ（/user/entry → depth 1 なら /user）を返す
+func urlPathPrefix(u *url.URL, depth int) string {
+	parts := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	if parts[0] == "" || depth == 0 {
+		return "/"
+	}
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// urlCount は集計の1行。count はマッチの件数、unique は正規化して重複を除いた URL の件数
+type urlCount struct {
+	name          string
+	count, unique int
+	prefixes      []*urlCount
+}
+
+// urlSummary はマッチを URL として集計した結果
+type urlSummary struct {
+	// urls は正規化して重複を除いた URL（昇順）
+	urls    []string
+	hosts   []*urlCount
+	total   int
+	invalid []string
+}
+
+// summarizeURLs は matches の文字列を正規化し、ホストとパスの接頭辞ごとに件数を数える
+func summarizeURLs(matches []Match, depth int) *urlSummary {
+	summary := &urlSummary{}
+	seen := make(map[string]bool)
+	hosts := make(map[string]*urlCount)
+	prefixes := make(map[string]map[string]*urlCount)
+
+	for _, match := range matches {
+		u, err := normalizeURL(match.Text)
+		if err != nil {
+			summary.invalid = append(summary.invalid, match.Text)
+			continue
+		}
+		summary.total++
+		normalized := u.String()
+		first := !seen[normalized]
+		if first {
+			seen[normalized] = true
+			summary.urls = append(summary.urls, normalized)
+		}
+
+		host := hosts[u.Host]
+		if host == nil {
+			host = &urlCount{name: u.Host}
+			hosts[u.Host] = host
+			prefixes[u.Host] = make(map[string]*urlCount)
+		}
+		prefixName := urlPathPrefix(u, depth)
+		prefix := prefixes[u.Host][prefixName]
+		if prefix == nil {
+			prefix = &urlCount{name: prefixName}
+			prefixes[u.Host][prefixName] = prefix
+			host.prefixes = append(host.prefixes, prefix)
+		}
+		for _, c := range []*urlCount{host, prefix} {
+			c.count++
+			if first {
+				c.unique++
+			}
+		}
+	}
+
+	sort.Strings(summary.urls)
+	for _, host := range hosts {
+		sortURLCounts(host.prefixes)
+		summary.hosts = append(summary.hosts, host)
+	}
+	sortURLCounts(summary.hosts)
+	return summary
+}
+
+// sortURLCounts は件数の多い順（同数は名前の順）に並べる
+func sortURLCounts(counts []*urlCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].name < counts[j].name
+	})
+}
+
+// printURLResults は正規化して重複を除いた URL を1行に1つずつ標準出力に表示し、
+// ホストとパスの接頭辞ごとの件数を標準エラー出力に表示する
+func printURLResults(matches []Match, opts *urlOptions) {
+	summary := summarizeURLs(matches, opts.depth)
+	for _, u := range summary.urls {
+		fmt.Println(u)
+	}
+
+	fmt.Fprint(os.Stderr, msg(msgURLHostHeader))
+	for _, host := range summary.hosts {
+		fmt.Fprint(os.Stderr, msgf(msgURLHostLine, host.name, host.count, host.unique))
+		for _, prefix := range host.prefixes {
+			fmt.Fprint(os.Stderr, msgf(msgURLPrefixLine, prefix.name, prefix.count, prefix.unique))
+		}
+	}
+	for _, raw := range summary.invalid {
+		fmt.Fprint(os.Stderr, msgf(msgURLInvalid, raw))
+	}
+	fmt.Fprint(os.Stderr, msgf(msgURLTotal, summary.total, len(summary.urls), len(summary.invalid)))
+}
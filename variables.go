@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// 置換文字列中の変数プレースホルダーの種類（${env:NAME}、${var:key}）
+const (
+	placeholderEnv = "env"
+	placeholderVar = "var"
+)
+
+// variables は --var key=value で指定された変数
+type variables map[string]string
+
+func (v variables) String() string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+v[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v variables) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return msgErrorf(msgInvalidVar, value)
+	}
+	v[key] = val
+	return nil
+}
+
+// substituteVariables は各パターンの置換文字列の ${env:NAME} と ${var:key} を値に置き換える。
+// 参照している変数が1つでも未指定の場合は、すべての未指定の変数を挙げてエラーにする
+func substituteVariables(config *Config, vars map[string]string, lookupEnv func(string) (string, bool)) error {
+	var missing []string
+	seen := make(map[string]bool)
+
+	for i := range config.Patterns {
+		pattern := &config.Patterns[i]
+		result, missingRefs, err := expandPlaceholders(pattern.Replacement, vars, lookupEnv)
+		if err != nil {
+			return msgErrorf(msgMalformedPlaceholder, pattern.Name, err)
+		}
+		for _, ref := range missingRefs {
+			if !seen[ref] {
+				seen[ref] = true
+				missing = append(missing, ref)
+			}
+		}
+		pattern.Replacement = result
+	}
+
+	if len(missing) > 0 {
+		return msgErrorf(msgMissingVariables, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkPlaceholders は値を置き換えずにプレースホルダーの書式だけを検証する
+func checkPlaceholders(config *Config) error {
+	for _, pattern := range config.Patterns {
+		_, _, err := expandPlaceholders(pattern.Replacement, nil, func(string) (string, bool) { return "", false })
+		if err != nil {
+			return msgErrorf(msgMalformedPlaceholder, pattern.Name, err)
+		}
+	}
+	return nil
+}
+
+// expandPlaceholders は置換文字列のプレースホルダーを展開する。
+// 値に含まれる $ は regexp の展開で解釈されないよう $$ にエスケープする。
+// $$ はregexpと同じく $ そのものを表すため、$${env:NAME} は展開しない。
+// 戻り値の2番目は値が見つからなかった参照（"${env:NAME}" の形式）
+func expandPlaceholders(s string, vars map[string]string, lookupEnv func(string) (string, bool)) (string, []string, error) {
+	var b strings.Builder
+	var missing []string
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if strings.HasPrefix(s[i:], "$$") {
+			b.WriteString("$$")
+			i++
+			continue
+		}
+
+		kind := ""
+		for _, k := range []string{placeholderEnv, placeholderVar} {
+			if strings.HasPrefix(s[i:], "${"+k+":") {
+				kind = k
+				break
+			}
+		}
+		if kind == "" {
+			// $1 や ${name} は regexp のグループ参照として残す
+			b.WriteByte(s[i])
+			continue
+		}
+
+		start := i + len("${"+kind+":")
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", nil, msgErrorf(msgUnclosedPlaceholder, s[i:])
+		}
+		name := s[start : start+end]
+		ref := s[i : start+end+1]
+		if name == "" {
+			return "", nil, msgErrorf(msgEmptyPlaceholder, ref)
+		}
+
+		var value string
+		var ok bool
+		if kind == placeholderEnv {
+			value, ok = lookupEnv(name)
+		} else {
+			value, ok = vars[name]
+		}
+		if !ok {
+			missing = append(missing, ref)
+		}
+		b.WriteString(strings.ReplaceAll(value, "$", "$$"))
+		i = start + end
+	}
+
+	return b.String(), missing, nil
+}
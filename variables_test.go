@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandPlaceholders(t *testing.T) {
+	vars := map[string]string{
+		"domain": "new.example.com",
+		"price":  "$100",
+	}
+	env := map[string]string{"TODAY": "2024-01-15", "EMPTY": ""}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name        string
+		replacement string
+		expected    string
+		missing     []string
+		errContains string
+	}{
+		{
+			name:        "group references are kept",
+			replacement: "$1 ${name} ${2}",
+			expected:    "$1 ${name} ${2}",
+		},
+		{
+			name:        "cli variable",
+			replacement: "https://${var:domain}$1",
+			expected:    "https://new.example.com$1",
+		},
+		{
+			name:        "environment variable",
+			replacement: "updated ${env:TODAY}",
+			expected:    "updated 2024-01-15",
+		},
+		{
+			name:        "empty environment variable is provided",
+			replacement: "[${env:EMPTY}]",
+			expected:    "[]",
+		},
+		{
+			name:        "dollar in value is escaped for regexp",
+			replacement: "${var:price}",
+			expected:    "$$100",
+		},
+		{
+			name:        "escaped placeholder is not expanded",
+			replacement: "$${env:TODAY}",
+			expected:    "$${env:TODAY}",
+		},
+		{
+			name:        "missing variables are reported",
+			replacement: "${var:missing} ${env:NOT_SET}",
+			expected:    " ",
+			missing:     []string{"${var:missing}", "${env:NOT_SET}"},
+		},
+		{
+			name:        "unclosed placeholder",
+			replacement: "${env:TODAY",
+			errContains: "プレースホルダーが閉じられていません",
+		},
+		{
+			name:        "empty name",
+			replacement: "${var:}",
+			errContains: "プレースホルダーの名前が空です",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, missing, err := expandPlaceholders(tt.replacement, vars, lookupEnv)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, result)
+			require.Equal(t, tt.missing, missing)
+		})
+	}
+}
+
+func TestSubstituteVariables(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Patterns: []Pattern{
+				{Name: "domain", Pattern: `https://old\.example\.com(/\S*)`, Replacement: "https://${var:domain}$1"},
+				{Name: "price", Pattern: `PRICE`, Replacement: "${var:price} (${env:CURRENCY})"},
+			},
+		}
+	}
+	lookupEnv := func(name string) (string, bool) {
+		if name == "CURRENCY" {
+			return "USD", true
+		}
+		return "", false
+	}
+
+	config := newConfig()
+	err := substituteVariables(config, variables{"domain": "new.example.com", "price": "$5"}, lookupEnv)
+	require.NoError(t, err)
+	result := performReplacements("https://old.example.com/page PRICE", config)
+	require.Equal(t, "https://new.example.com/page $5 (USD)", result)
+
+	err = substituteVariables(newConfig(), variables{}, lookupEnv)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "${var:domain}, ${var:price}")
+}
+
+func TestVariables_Set(t *testing.T) {
+	vars := variables{}
+	require.NoError(t, vars.Set("domain=example.com"))
+	require.NoError(t, vars.Set("query=a=b"))
+	require.Equal(t, variables{"domain": "example.com", "query": "a=b"}, vars)
+	require.Equal(t, "domain=example.com,query=a=b", vars.String())
+
+	require.Error(t, vars.Set("novalue"))
+	require.Error(t, vars.Set("=value"))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// wholeMatch は type: wordlist の置換文字列で $0 を展開するための正規表現
+var wholeMatch = regexp.MustCompile(`(?s)\A.*\z`)
+
+// loadWordlist は words と words_file の文字列から type: wordlist のマッチャーを作る
+func loadWordlist(pattern Pattern) (*ahoCorasick, error) {
+	words := append([]string{}, pattern.Words...)
+	if pattern.WordsFile != "" {
+		fileWords, err := readWordsFile(pattern.WordsFile)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, fileWords...)
+	}
+
+	nonEmpty := 0
+	for _, word := range words {
+		if word != "" {
+			nonEmpty++
+		}
+	}
+	if nonEmpty == 0 {
+		return nil, msgErrorf(msgWordlistEmpty, pattern.Name)
+	}
+	return newAhoCorasick(words, pattern.WholeWord), nil
+}
+
+// readWordsFile は1行に1語を書いたファイルを読み込む。空行と # で始まる行は読み飛ばす
+func readWordsFile(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, msgErrorf(msgWordsFileReadError, err)
+	}
+
+	var words []string
+	for _, line := range strings.Split(strings.TrimPrefix(string(data), "\ufeff"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, nil
+}
+
+// replaceLocations は locs の各範囲をパターンの置換文字列（または replace_template）で置き換える。
+// 置換文字列の $0 はマッチした文字列に展開し、$$ は $ を表す。置換結果は escapeReplacement でエスケープする
+func replaceLocations(text string, locs [][]int, pattern Pattern, counters templateCounters) (string, error) {
+	var tmpl *template.Template
+	if pattern.ReplaceTemplate != "" {
+		var err error
+		tmpl, err = compileReplaceTemplate(pattern, counters)
+		if err != nil {
+			return text, err
+		}
+	}
+
+	var b, expanded strings.Builder
+	prev := 0
+	for i, loc := range locs {
+		match := text[loc[0]:loc[1]]
+		b.WriteString(text[prev:loc[0]])
+		expanded.Reset()
+		if tmpl != nil {
+			data := templateMatch{Match: match, Groups: []string{match}, Named: map[string]string{}, N: i + 1}
+			if err := tmpl.Execute(&expanded, data); err != nil {
+				return text, err
+			}
+		} else {
+			expanded.Write(wholeMatch.ExpandString(nil, pattern.Replacement, match, wholeMatch.FindStringSubmatchIndex(match)))
+		}
+		b.WriteString(pattern.escapeReplacement(expanded.String()))
+		prev = loc[1]
+	}
+	b.WriteString(text[prev:])
+	return b.String(), nil
+}
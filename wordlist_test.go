@@ -0,0 +1,133 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerformReplacements_LiteralAndWordlist(t *testing.T) {
+	tmpDir := t.TempDir()
+	wordsFile := filepath.Join(tmpDir, "words.txt")
+	writeFile(t, wordsFile, "# NGワード\r\n馬鹿\r\n\r\nアホ\r\n")
+
+	tests := []struct {
+		name     string
+		text     string
+		patterns []Pattern
+		expected string
+	}{
+		{
+			name: "literal with regex metacharacters",
+			text: "price: $5.00 (tax) and $5X00",
+			patterns: []Pattern{
+				{Name: "price", Type: patternTypeLiteral, Pattern: "$5.00 (tax)", Replacement: "[PRICE]"},
+			},
+			expected: "price: [PRICE] and $5X00",
+		},
+		{
+			name: "literal keeps braces",
+			text: "{{name}} and {{other}}",
+			patterns: []Pattern{
+				{Name: "placeholder", Type: patternTypeLiteral, Pattern: "{{name}}", Replacement: "山田"},
+			},
+			expected: "山田 and {{other}}",
+		},
+		{
+			name: "wordlist from list and file",
+			text: "馬鹿とアホとバカ",
+			patterns: []Pattern{
+				{Name: "ng", Type: patternTypeWordlist, Words: []string{"バカ"}, WordsFile: wordsFile, Replacement: "***"},
+			},
+			expected: "***と***と***",
+		},
+		{
+			name: "wordlist replacement expands $0",
+			text: "use foo.bar and foo.baz",
+			patterns: []Pattern{
+				{Name: "code", Type: patternTypeWordlist, Words: []string{"foo.bar", "foo.baz"}, Replacement: "`$0` $$"},
+			},
+			expected: "use `foo.bar` $ and `foo.baz` $",
+		},
+		{
+			name: "wordlist whole word",
+			text: "cat category cat",
+			patterns: []Pattern{
+				{Name: "cat", Type: patternTypeWordlist, Words: []string{"cat"}, WholeWord: true, Replacement: "dog"},
+			},
+			expected: "dog category dog",
+		},
+		{
+			name: "wordlist with replace_template",
+			text: "alpha beta alpha",
+			patterns: []Pattern{
+				{Name: "greek", Type: patternTypeWordlist, Words: []string{"alpha", "beta"}, ReplaceTemplate: `{{upper .Match}}{{.N}}`},
+			},
+			expected: "ALPHA1 BETA2 ALPHA3",
+		},
+		{
+			name: "empty wordlist is skipped",
+			text: "unchanged",
+			patterns: []Pattern{
+				{Name: "empty", Type: patternTypeWordlist, Replacement: "x"},
+			},
+			expected: "unchanged",
+		},
+		{
+			name: "unknown type is skipped",
+			text: "unchanged",
+			patterns: []Pattern{
+				{Name: "bogus", Type: "glob", Pattern: "un*", Replacement: "x"},
+			},
+			expected: "unchanged",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := performReplacements(tt.text, &Config{Patterns: tt.patterns})
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestExtractMatches_LiteralAndWordlist(t *testing.T) {
+	config := &Config{Patterns: []Pattern{
+		{Name: "literal", Type: patternTypeLiteral, Pattern: "a.b"},
+		{Name: "words", Type: patternTypeWordlist, Words: []string{"ERROR", "FATAL"}},
+	}}
+	text := "axb a.b\nINFO\nERROR x\nFATAL y ERROR"
+
+	matches := extractMatches(text, config)
+	require.Equal(t, []Match{
+		{PatternName: "literal", Line: 1, Text: "a.b", Matches: []string{"a.b"}},
+		{PatternName: "words", Line: 3, Text: "ERROR", Matches: []string{"ERROR"}},
+		{PatternName: "words", Line: 4, Text: "FATAL", Matches: []string{"FATAL"}},
+		{PatternName: "words", Line: 4, Text: "ERROR", Matches: []string{"ERROR"}},
+	}, matches)
+}
+
+func TestLoadConfig_Wordlist(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFile(t, filepath.Join(tmpDir, "lists", "ng.txt"), "禁止語\n")
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configFile, `definitions:
+  x: 'unused'
+patterns:
+  - name: "ng"
+    type: wordlist
+    words_file: lists/ng.txt
+    words: ["NG"]
+    replacement: '[伏字]'
+  - name: "literal"
+    type: literal
+    pattern: '{{x}}'
+    replacement: 'X'`)
+
+	config, err := loadConfig(configFile)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(tmpDir, "lists", "ng.txt"), config.Patterns[0].WordsFile)
+	require.Equal(t, "{{x}}", config.Patterns[1].Pattern)
+	require.Equal(t, "[伏字] [伏字] X", performReplacements("禁止語 NG {{x}}", config))
+}